@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// etherTypeARP is the EtherType of ARP frames.
+const etherTypeARP = 0x0806
+
+// arpInterface picks the interface to ARP from: --interface if given,
+// otherwise the one whose IPv4 subnet holds the first target.
+func arpInterface(targets targetSet) (*net.Interface, error) {
+	if *ifaceName != "" {
+		return net.InterfaceByName(*ifaceName)
+	}
+	first := net.ParseIP(intToIP(targets[0].start))
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	for i := range ifaces {
+		addrs, err := ifaces[i].Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil && ipNet.Contains(first) {
+				return &ifaces[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no interface is on-link for %s; use --interface", first)
+}
+
+// interfaceIPv4 returns the first IPv4 address assigned to iface.
+func interfaceIPv4(iface *net.Interface) (net.IP, error) {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			if ip := ipNet.IP.To4(); ip != nil {
+				return ip, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("interface %s has no IPv4 address", iface.Name)
+}
+
+// arpRequest builds a broadcast Ethernet frame asking who has target.
+func arpRequest(srcMAC net.HardwareAddr, srcIP net.IP, target uint32) []byte {
+	b := make([]byte, 42)
+	copy(b[0:6], []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	copy(b[6:12], srcMAC)
+	binary.BigEndian.PutUint16(b[12:], etherTypeARP)
+	binary.BigEndian.PutUint16(b[14:], 1)      // hardware type: Ethernet
+	binary.BigEndian.PutUint16(b[16:], 0x0800) // protocol type: IPv4
+	b[18], b[19] = 6, 4
+	binary.BigEndian.PutUint16(b[20:], 1) // op: request
+	copy(b[22:28], srcMAC)
+	copy(b[28:32], srcIP.To4())
+	// target hardware address stays zero
+	binary.BigEndian.PutUint32(b[38:], target)
+	return b
+}
+
+// handleARPFrame records the sender of an ARP reply frame if it is one of
+// the targets.
+func handleARPFrame(b []byte, targets targetSet) {
+	if len(b) < 42 || binary.BigEndian.Uint16(b[12:]) != etherTypeARP || binary.BigEndian.Uint16(b[20:]) != 2 {
+		return
+	}
+	ip := binary.BigEndian.Uint32(b[28:])
+	if !targets.contains(ip) {
+		return
+	}
+	engineStats.replies.Add(1)
+	mac := make(net.HardwareAddr, 6)
+	copy(mac, b[22:28])
+	recordMAC(intToIP(ip), mac)
+	add(intToIP(ip), "arp")
+}
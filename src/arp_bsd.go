@@ -0,0 +1,143 @@
+//go:build (darwin || dragonfly || freebsd || netbsd || openbsd) && !noarp
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+func init() { registerFeature("arp") }
+
+// arpWait is how long to keep listening for replies after the last request.
+const arpWait = 2 * time.Second
+
+// arpFilter passes only ARP replies up from the kernel:
+// ether type 0x0806 and ARP op 2.
+var arpFilter = []syscall.BpfInsn{
+	*syscall.BpfStmt(syscall.BPF_LD+syscall.BPF_H+syscall.BPF_ABS, 12),
+	*syscall.BpfJump(syscall.BPF_JMP+syscall.BPF_JEQ+syscall.BPF_K, etherTypeARP, 0, 3),
+	*syscall.BpfStmt(syscall.BPF_LD+syscall.BPF_H+syscall.BPF_ABS, 20),
+	*syscall.BpfJump(syscall.BPF_JMP+syscall.BPF_JEQ+syscall.BPF_K, 2, 0, 1),
+	*syscall.BpfStmt(syscall.BPF_RET+syscall.BPF_K, 1500),
+	*syscall.BpfStmt(syscall.BPF_RET+syscall.BPF_K, 0),
+}
+
+// scanARP sends an ARP who-has for every target out of iface through a
+// BPF device and records each responder with its MAC. It returns how many
+// targets were left unprobed when the deadline hit.
+func scanARP(iface *net.Interface, targets targetSet, first []uint32) (int64, error) {
+	srcIP, err := interfaceIPv4(iface)
+	if err != nil {
+		return 0, err
+	}
+	fd, err := openBPF(iface.Name)
+	if err != nil {
+		return 0, err
+	}
+	defer syscall.Close(fd)
+	buflen, err := syscall.BpfBuflen(fd)
+	if err != nil {
+		return 0, err
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		readBPFReplies(fd, buflen, targets, done)
+	}()
+
+	log.Printf("ARP scanning from %s (%s)", iface.Name, display(srcIP.String()))
+	var unprobed int64
+	forEachTarget(targets, first, func(ip uint32) {
+		scanGate.wait()
+		if pastDeadline() {
+			unprobed++
+			return
+		}
+		frame := arpRequest(iface.HardwareAddr, srcIP, ip)
+		for attempt := 0; ; attempt++ {
+			_, err := syscall.Write(fd, frame)
+			if err == nil {
+				engineStats.sent.Add(1)
+				break
+			}
+			if !isResourceError(err) || attempt == 5 {
+				engineStats.sendErrors.Add(1)
+				scanError("Error sending ARP request for %s: %s", intToIP(ip), err)
+				break
+			}
+			backoff(attempt)
+		}
+	})
+
+	settle(arpWait)
+	close(done)
+	wg.Wait()
+	return unprobed, nil
+}
+
+// openBPF opens a free BPF device, attaches it to the named interface and
+// configures it for sending our own frames and reading ARP replies.
+func openBPF(name string) (int, error) {
+	fd, err := syscall.Open("/dev/bpf", syscall.O_RDWR, 0) // cloning device
+	for i := 0; err != nil && i < 256; i++ {
+		fd, err = syscall.Open(fmt.Sprintf("/dev/bpf%d", i), syscall.O_RDWR, 0)
+		if err != nil && !errors.Is(err, syscall.EBUSY) && !errors.Is(err, syscall.ENOENT) {
+			return -1, err
+		}
+	}
+	if err != nil {
+		return -1, errors.New("no free BPF device")
+	}
+
+	tv := syscall.NsecToTimeval(int64(200 * time.Millisecond))
+	for _, setup := range []func() error{
+		func() error { return syscall.SetBpfInterface(fd, name) },
+		func() error { return syscall.SetBpfImmediate(fd, 1) },  // deliver replies as they arrive
+		func() error { return syscall.SetBpfHeadercmpl(fd, 1) }, // we fill in the source MAC
+		func() error { return syscall.SetBpfTimeout(fd, &tv) },  // so reads can notice done
+		func() error { return syscall.SetBpf(fd, arpFilter) },
+	} {
+		if err := setup(); err != nil {
+			syscall.Close(fd)
+			return -1, err
+		}
+	}
+	return fd, nil
+}
+
+// readBPFReplies records ARP replies from targets until done is closed.
+// One read can return several frames, each behind a bpf_hdr and padded to
+// BPF_ALIGNMENT.
+func readBPFReplies(fd, buflen int, targets targetSet, done <-chan struct{}) {
+	buf := make([]byte, buflen)
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		n, err := syscall.Read(fd, buf)
+		if err != nil || n == 0 {
+			continue // timeout; check done again
+		}
+		for off := 0; off+int(unsafe.Sizeof(syscall.BpfHdr{})) <= n; {
+			hdr := (*syscall.BpfHdr)(unsafe.Pointer(&buf[off]))
+			start, end := off+int(hdr.Hdrlen), off+int(hdr.Hdrlen)+int(hdr.Caplen)
+			if end > n {
+				break
+			}
+			handleARPFrame(buf[start:end], targets)
+			off += (int(hdr.Hdrlen) + int(hdr.Caplen) + syscall.BPF_ALIGNMENT - 1) &^ (syscall.BPF_ALIGNMENT - 1)
+		}
+	}
+}
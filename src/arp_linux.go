@@ -0,0 +1,104 @@
+//go:build !noarp
+
+package main
+
+import (
+	"log"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+func init() { registerFeature("arp") }
+
+// arpWait is how long to keep listening for replies after the last request.
+const arpWait = 2 * time.Second
+
+// scanARP sends an ARP who-has for every target out of iface over an
+// AF_PACKET socket and records each responder with its MAC. It returns how
+// many targets were left unprobed when the deadline hit.
+func scanARP(iface *net.Interface, targets targetSet, first []uint32) (int64, error) {
+	srcIP, err := interfaceIPv4(iface)
+	if err != nil {
+		return 0, err
+	}
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, int(htons(syscall.ETH_P_ARP)))
+	if err != nil {
+		return 0, err
+	}
+	defer syscall.Close(fd)
+
+	if err := syscall.Bind(fd, &syscall.SockaddrLinklayer{Protocol: htons(syscall.ETH_P_ARP), Ifindex: iface.Index}); err != nil {
+		return 0, err
+	}
+	tv := syscall.NsecToTimeval(int64(200 * time.Millisecond))
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		return 0, err
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		readARPReplies(fd, targets, done)
+	}()
+
+	log.Printf("ARP scanning from %s (%s)", iface.Name, display(srcIP.String()))
+	dst := &syscall.SockaddrLinklayer{
+		Protocol: htons(syscall.ETH_P_ARP),
+		Ifindex:  iface.Index,
+		Halen:    6,
+		Addr:     [8]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+	}
+	var unprobed int64
+	forEachTarget(targets, first, func(ip uint32) {
+		scanGate.wait()
+		if pastDeadline() {
+			unprobed++
+			return
+		}
+		frame := arpRequest(iface.HardwareAddr, srcIP, ip)
+		for attempt := 0; ; attempt++ {
+			err := syscall.Sendto(fd, frame, 0, dst)
+			if err == nil {
+				engineStats.sent.Add(1)
+				break
+			}
+			if !isResourceError(err) || attempt == 5 {
+				engineStats.sendErrors.Add(1)
+				scanError("Error sending ARP request for %s: %s", intToIP(ip), err)
+				break
+			}
+			backoff(attempt)
+		}
+	})
+
+	settle(arpWait)
+	close(done)
+	wg.Wait()
+	return unprobed, nil
+}
+
+// readARPReplies records ARP replies from targets until done is closed.
+func readARPReplies(fd int, targets targetSet, done <-chan struct{}) {
+	buf := make([]byte, 1500)
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			continue // timeout; check done again
+		}
+		handleARPFrame(buf[:n], targets)
+	}
+}
+
+// htons converts a short to network byte order.
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
@@ -0,0 +1,14 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd) || noarp
+
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+// scanARP needs AF_PACKET (Linux) or BPF (macOS and the BSDs), and
+// is left out of builds with the noarp tag.
+func scanARP(iface *net.Interface, targets targetSet, first []uint32) (int64, error) {
+	return 0, errors.New("ARP scanning is not available in this build (Linux, macOS and the BSDs, without -tags noarp)")
+}
@@ -0,0 +1,128 @@
+//go:build !noports
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() { registerFeature("banners") }
+
+// bannerMax caps how many bytes of a banner are read and kept.
+const bannerMax = 512
+
+// httpPorts are sent an HTTP request, since HTTP servers wait for the
+// client to speak first. SSH, SMTP, FTP, POP3 and IMAP greet on connect.
+var httpPorts = map[int]bool{80: true, 81: true, 591: true, 8000: true, 8008: true, 8080: true, 8081: true, 8888: true}
+
+// grabBanners connects again to every open TCP port found, reads what the
+// service sends and attaches the banner and any identified service and
+// version to the port result.
+func (ps *portScan) grabBanners() {
+	ps.eachOpenTCP(func(ip string, port int) func(*portResult) {
+		banner := grabBanner(ip, port, ps.timeout)
+		if banner == "" {
+			return nil
+		}
+		service, version := identifyBanner(banner)
+		return func(p *portResult) {
+			p.Banner, p.Service, p.Version = cleanBanner(banner), service, version
+		}
+	})
+}
+
+// grabBanner returns the first bytes a TCP service sends, probing known
+// HTTP ports with a HEAD request.
+func grabBanner(ip string, port int, timeout time.Duration) string {
+	conn, err := net.DialTimeout("tcp4", net.JoinHostPort(ip, strconv.Itoa(port)), timeout)
+	if err != nil {
+		return ""
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * timeout))
+
+	isHTTP := httpPorts[port]
+	if isHTTP {
+		fmt.Fprintf(conn, "HEAD / HTTP/1.0\r\nHost: %s\r\nUser-Agent: scli\r\n\r\n", ip)
+	}
+
+	// Read until the greeting line (or HTTP header block) is complete
+	buf := make([]byte, 0, bannerMax)
+	for len(buf) < bannerMax {
+		n, err := conn.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		if err != nil {
+			break
+		}
+		if isHTTP && strings.Contains(string(buf), "\r\n\r\n") {
+			break
+		}
+		if !isHTTP && strings.Contains(string(buf), "\n") {
+			break
+		}
+	}
+
+	// Say goodbye to FTP/SMTP/POP3/IMAP servers rather than just hanging up
+	if s := string(buf); strings.HasPrefix(s, "220") || strings.HasPrefix(s, "+OK") {
+		conn.Write([]byte("QUIT\r\n"))
+	} else if strings.HasPrefix(s, "* OK") {
+		conn.Write([]byte("a LOGOUT\r\n"))
+	}
+	return string(buf)
+}
+
+// identifyBanner guesses the service and its version from a banner. Both
+// come from the remote end, so they are cleaned like HTTP titles.
+func identifyBanner(banner string) (service, version string) {
+	defer func() {
+		service, version = cleanText(service, httpTextMax), cleanText(version, httpTextMax)
+	}()
+	first, _, _ := strings.Cut(banner, "\n")
+	first = strings.TrimSpace(first)
+	switch {
+	case strings.HasPrefix(first, "SSH-"):
+		// SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13
+		if parts := strings.SplitN(first, "-", 3); len(parts) == 3 {
+			version = parts[2]
+		}
+		return "ssh", version
+	case strings.HasPrefix(first, "HTTP/"):
+		for _, line := range strings.Split(banner, "\n") {
+			if k, v, ok := strings.Cut(line, ":"); ok && strings.EqualFold(k, "Server") {
+				version = strings.TrimSpace(v)
+			}
+		}
+		return "http", version
+	case strings.HasPrefix(first, "220"):
+		version = strings.TrimSpace(strings.TrimLeft(first[3:], " -"))
+		upper := strings.ToUpper(first)
+		switch {
+		case strings.Contains(upper, "FTP"):
+			return "ftp", version
+		case strings.Contains(upper, "SMTP"), strings.Contains(upper, "MAIL"):
+			return "smtp", version
+		}
+		return "", ""
+	case strings.HasPrefix(first, "+OK"):
+		return "pop3", strings.TrimSpace(first[3:])
+	case strings.HasPrefix(first, "* OK"):
+		return "imap", strings.TrimSpace(first[4:])
+	}
+	return "", ""
+}
+
+// cleanBanner keeps the first line of a banner with unprintable bytes
+// replaced, so it is safe to print.
+func cleanBanner(banner string) string {
+	first, _, _ := strings.Cut(banner, "\n")
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e {
+			return '.'
+		}
+		return r
+	}, strings.TrimRight(first, "\r"))
+}
@@ -0,0 +1,39 @@
+package main
+
+import "time"
+
+// clock is the scan engine's source of time. Deadlines, retry backoff and
+// settle waits go through it, so tests can swap in a fake clock and run
+// timing logic instantly and deterministically. Socket read deadlines
+// stay on the wall clock, because the kernel enforces them.
+type clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+// systemClock is the real wall clock.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time        { return time.Now() }
+func (systemClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+// scanClock is the clock the scan runs on.
+var scanClock clock = systemClock{}
+
+// backoff waits before retrying a send that failed for lack of buffers or
+// descriptors: 10ms after the first failure, doubling with each attempt.
+func backoff(attempt int) {
+	scanClock.Sleep(time.Duration(10<<attempt) * time.Millisecond)
+}
+
+// settle waits d for the replies to the last probes, cut short by the
+// scan deadline.
+func settle(d time.Duration) {
+	wait := scanClock.Now().Add(d)
+	if !scanDeadline.IsZero() && scanDeadline.Before(wait) {
+		wait = scanDeadline
+	}
+	if d := wait.Sub(scanClock.Now()); d > 0 {
+		scanClock.Sleep(d)
+	}
+}
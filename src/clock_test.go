@@ -0,0 +1,117 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock whose Sleep returns at once after advancing Now by
+// the requested duration, so timing logic runs instantly. Every sleep is
+// recorded for the test to inspect.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+}
+
+// useFakeClock runs the scan on a fake clock for the duration of the test.
+func useFakeClock(t *testing.T) *fakeClock {
+	t.Helper()
+	c := &fakeClock{now: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	setFlag(t, &scanClock, clock(c))
+	return c
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sleeps = append(c.sleeps, d)
+	c.now = c.now.Add(d)
+}
+
+// advance moves the clock forward without recording a sleep.
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestPastDeadline(t *testing.T) {
+	resetScan(t)
+	c := useFakeClock(t)
+	if pastDeadline() {
+		t.Error("past deadline without one set")
+	}
+	scanDeadline = c.Now().Add(90 * time.Second)
+	c.advance(90 * time.Second)
+	if pastDeadline() {
+		t.Error("past deadline at the deadline itself")
+	}
+	c.advance(time.Nanosecond)
+	if !pastDeadline() {
+		t.Error("not past deadline after it")
+	}
+}
+
+func TestBackoffDoubles(t *testing.T) {
+	c := useFakeClock(t)
+	start := c.Now()
+	for attempt := 0; attempt < 5; attempt++ {
+		backoff(attempt)
+	}
+	want := []time.Duration{10, 20, 40, 80, 160}
+	for i := range want {
+		want[i] *= time.Millisecond
+	}
+	if len(c.sleeps) != len(want) {
+		t.Fatalf("slept %v, want %v", c.sleeps, want)
+	}
+	for i := range want {
+		if c.sleeps[i] != want[i] {
+			t.Errorf("attempt %d slept %v, want %v", i, c.sleeps[i], want[i])
+		}
+	}
+	if got := c.Now().Sub(start); got != 310*time.Millisecond {
+		t.Errorf("clock advanced %v, want 310ms", got)
+	}
+}
+
+func TestSettleStopsAtDeadline(t *testing.T) {
+	resetScan(t)
+	c := useFakeClock(t)
+	settle(2 * time.Second)
+	scanDeadline = c.Now().Add(300 * time.Millisecond)
+	settle(2 * time.Second)
+	settle(2 * time.Second) // deadline already reached: no wait at all
+
+	want := []time.Duration{2 * time.Second, 300 * time.Millisecond}
+	if len(c.sleeps) != len(want) || c.sleeps[0] != want[0] || c.sleeps[1] != want[1] {
+		t.Errorf("slept %v, want %v", c.sleeps, want)
+	}
+}
+
+// Reverse DNS after a scan that ran out its deadline sends no queries, so
+// a slow resolver can't hold the run past it.
+func TestLookupHostnamesStopsAtDeadline(t *testing.T) {
+	resetScan(t)
+	buf := captureLog(t)
+	c := useFakeClock(t)
+	scanDeadline = c.Now().Add(-time.Second)
+
+	start := time.Now()
+	names := lookupHostnames([]string{"198.51.100.7", "198.51.100.20"}, 2, time.Minute)
+	if len(names) != 0 || time.Since(start) > time.Second {
+		t.Errorf("looked up %v in %v after the deadline", names, time.Since(start))
+	}
+	if !strings.Contains(buf.String(), "2 reverse DNS lookups skipped") {
+		t.Errorf("log = %q", buf)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+)
+
+// discoveryOrder lists the --discovery methods in the order they run.
+// Cheap probes go first, and each later method only probes the targets
+// the earlier ones didn't find, so adding methods costs little on
+// networks where ICMP already works.
+var discoveryOrder = []string{"arp", "icmp", "timestamp", "tcp", "udp"}
+
+// tcpPingPorts are the ports TCP discovery probes; --tcp-ping sets them.
+var tcpPingPorts = []int{80, 443}
+
+// parseDiscovery parses a comma-separated --discovery list.
+func parseDiscovery(spec string) (map[string]bool, error) {
+	methods := make(map[string]bool)
+	for _, m := range strings.Split(spec, ",") {
+		if m = strings.TrimSpace(m); m == "" {
+			continue
+		}
+		if !slices.Contains(discoveryOrder, m) {
+			return nil, fmt.Errorf("unknown discovery method %q (known: %s)", m, strings.Join(discoveryOrder, ", "))
+		}
+		methods[m] = true
+	}
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("no discovery methods in %q", spec)
+	}
+	return methods, nil
+}
+
+// sortedMethods returns the methods set in methods in discoveryOrder.
+func sortedMethods(methods map[string]bool) []string {
+	var out []string
+	for _, m := range discoveryOrder {
+		if methods[m] {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// discover probes the targets with each of methods in turn. Any answer
+// marks a host up, and the first method to get one is recorded. It
+// returns how many targets the deadline left unprobed.
+func discover(targets targetSet, first []uint32, methods map[string]bool) int64 {
+	// Every target one pass skips at the deadline is skipped by the later
+	// ones too, so the largest count covers them all
+	var unprobed int64
+	if methods["arp"] {
+		iface, err := arpInterface(targets)
+		if err == nil {
+			unprobed, err = scanARP(iface, targets, first)
+		}
+		switch {
+		case err != nil && *isolationTest:
+			// The isolation test adds ARP itself; the other methods
+			// still run
+			scanError("Error running ARP scan, isolation over ARP not checked: %s", err)
+		case err != nil:
+			log.Fatalf("Error running ARP scan: %s", err)
+		}
+	}
+	if methods["icmp"] || methods["timestamp"] {
+		unprobed = max(unprobed, scanICMP(targets, first, methods["icmp"], methods["timestamp"]))
+	}
+	if methods["tcp"] {
+		unprobed = max(unprobed, scanTCPPing(targets, first, tcpPingPorts))
+	}
+	if methods["udp"] {
+		unprobed = max(unprobed, scanUDPPing(targets, first, *udpPingPort))
+	}
+	return unprobed
+}
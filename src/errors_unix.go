@@ -0,0 +1,21 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isResourceError reports whether err means the OS ran out of buffers or
+// descriptors, so the scan should slow down rather than give up.
+func isResourceError(err error) bool {
+	return errors.Is(err, syscall.ENOBUFS) || errors.Is(err, syscall.EAGAIN) ||
+		errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE)
+}
+
+// isConnRefused reports whether err means the peer actively refused: a TCP
+// RST, or an ICMP port unreachable on a connected UDP socket.
+func isConnRefused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Winsock error codes for exhausted buffers and sockets.
+const (
+	wsaENOBUFS      = syscall.Errno(10055)
+	wsaEMFILE       = syscall.Errno(10024)
+	wsaEWOULDBLOCK  = syscall.Errno(10035)
+	wsaECONNRESET   = syscall.Errno(10054)
+	wsaECONNREFUSED = syscall.Errno(10061)
+)
+
+// isResourceError reports whether err means the OS ran out of buffers or
+// descriptors, so the scan should slow down rather than give up.
+func isResourceError(err error) bool {
+	return errors.Is(err, wsaENOBUFS) || errors.Is(err, wsaEMFILE) || errors.Is(err, wsaEWOULDBLOCK)
+}
+
+// isConnRefused reports whether err means the peer actively refused: a TCP
+// RST, or an ICMP port unreachable on a connected UDP socket (which
+// Winsock reports as a connection reset).
+func isConnRefused(err error) bool {
+	return errors.Is(err, wsaECONNREFUSED) || errors.Is(err, wsaECONNRESET)
+}
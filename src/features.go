@@ -0,0 +1,38 @@
+package main
+
+// Optional subsystems register themselves here from an init function in
+// the file that implements them, so the set of features always matches
+// what was compiled in. Build tags strip subsystems from small builds:
+//
+//	noports  drops "scli ports" (TCP connect, SYN and UDP scanning)
+//	noarp    drops ARP discovery
+//
+// e.g. a discovery-only binary for an embedded router:
+//
+//	go build -tags noports,noarp ./src
+
+// enabledFeatures holds the names of the features present in this binary.
+var enabledFeatures = make(map[string]bool)
+
+// registerFeature marks features as available in this binary.
+func registerFeature(names ...string) {
+	for _, name := range names {
+		enabledFeatures[name] = true
+	}
+}
+
+// featureEnabled reports whether a feature is available in this binary.
+func featureEnabled(name string) bool {
+	return enabledFeatures[name]
+}
+
+// Every probe backend and feature scli knows about, present or not, so
+// that "scli version --build-info" can report what's missing too.
+var (
+	knownBackends = []string{"icmp-raw", "icmp-unprivileged", "arp", "tcp-connect", "tcp-syn", "udp"}
+	knownFeatures = []string{"banners", "gateway-detection", "http-fingerprint", "neighbor-table", "pause-signal", "ports", "reverse-dns", "tcp-ping", "tls-certs"}
+)
+
+func init() {
+	registerFeature("icmp-raw", "gateway-detection", "neighbor-table", "reverse-dns")
+}
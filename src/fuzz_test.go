@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+)
+
+// Fuzz targets for everything that parses user or network input. Run one
+// with e.g. go test ./src -run '^$' -fuzz FuzzParseTarget -fuzztime 30s.
+
+func FuzzParseTarget(f *testing.F) {
+	for _, s := range []string{
+		"10.0.0.5", "192.168.1.1-192.168.1.254", "10.0.0.0/22", "192.168.1-3.*",
+		"10.0.0.1-254", "*.*.*.*", "0.0.0.0/0", "1-254.1-254.1-254.1", "::1", "a-b",
+	} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		ranges, err := parseTarget(s)
+		if err != nil {
+			return
+		}
+		for _, r := range ranges {
+			if r.start > r.end {
+				t.Fatalf("parseTarget(%q) produced bad range %+v", s, r)
+			}
+		}
+		set := mergeRanges(ranges)
+		for i := 1; i < len(set); i++ {
+			if set[i-1].end == math.MaxUint32 || set[i].start <= set[i-1].end+1 {
+				t.Fatalf("parseTarget(%q) merged into overlapping ranges %v", s, set)
+			}
+		}
+	})
+}
+
+// sessionRecord encodes one record in the --record session format.
+func sessionRecord(peer string, pkt []byte) []byte {
+	b := make([]byte, 9, 11+len(peer)+len(pkt))
+	b[8] = byte(len(peer))
+	b = append(b, peer...)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(pkt)))
+	return append(b, pkt...)
+}
+
+func FuzzReplaySession(f *testing.F) {
+	reply := []byte{0, 0, 0xff, 0xfe, 0, 1, 0, 1}
+	f.Add(sessionRecord("10.0.0.1", reply))
+	f.Add(append(sessionRecord("10.0.0.1", reply), sessionRecord("10.0.0.2", reply[:3])...))
+	f.Add(sessionRecord("not-an-ip", reply))
+	f.Add(append([]byte(sessionMagic+"\x02"), sessionRecord("10.0.0.1", reply)...))
+	f.Add(appendRecord([]byte(sessionMagic+"\x03"), recordedReply{peer: "10.0.0.1", ttl: 64, rtt: time.Millisecond, pkt: reply}))
+	f.Add([]byte(sessionMagic + "\x09"))
+	f.Add([]byte{1, 2, 3})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		resetScan(t)
+		captureLog(t)
+		replaySession(bytes.NewReader(data))
+		for _, ip := range results() {
+			if intToIP(ipToInt(ip)) != ip {
+				t.Fatalf("replay recorded non-IPv4 host %q", ip)
+			}
+		}
+	})
+}
+
+func FuzzHandleARPFrame(f *testing.F) {
+	f.Add(arpRequest([]byte{2, 0, 0, 0, 0, 1}, []byte{10, 0, 0, 1}, 0x0a000002))
+	reply := arpRequest([]byte{2, 0, 0, 0, 0, 2}, []byte{10, 0, 0, 2}, 0x0a000001)
+	reply[21] = 2
+	f.Add(reply)
+	f.Add(reply[:30])
+	all := mustTargets(f, "0.0.0.0/0")
+	f.Fuzz(func(t *testing.T, frame []byte) {
+		resetScan(t)
+		captureLog(t)
+		handleARPFrame(frame, all)
+		if n := len(results()); n > 1 {
+			t.Fatalf("one frame recorded %d hosts", n)
+		}
+	})
+}
+
+func FuzzParseCountExpr(f *testing.F) {
+	for _, s := range []string{"3", ">=3", "<= 10", "==0", ">", "=-1", "9999999999999999999"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		op, _, err := parseCountExpr(s)
+		if err == nil && op != "=" && op != ">=" && op != "<=" && op != ">" && op != "<" {
+			t.Fatalf("parseCountExpr(%q) returned operator %q", s, op)
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// defaultGateways returns the IPv4 gateways of the default routes, read
+// from /proc/net/route.
+func defaultGateways() []string {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	return parseRoutes(f)
+}
+
+// parseRoutes returns the gateways of the default routes in a routing
+// table in the format of /proc/net/route.
+func parseRoutes(r io.Reader) []string {
+	var gws []string
+	sc := bufio.NewScanner(r)
+	sc.Scan() // header
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		gw, err := strconv.ParseUint(fields[2], 16, 32)
+		if err != nil || gw == 0 {
+			continue
+		}
+		// The kernel prints the address as a host-order integer
+		ip := make(net.IP, 4)
+		binary.NativeEndian.PutUint32(ip, uint32(gw))
+		gws = append(gws, ip.String())
+	}
+	return gws
+}
@@ -0,0 +1,27 @@
+//go:build !linux && !windows
+
+package main
+
+import (
+	"net"
+	"os/exec"
+	"strings"
+)
+
+// defaultGateways returns the IPv4 gateway of the default route, parsed
+// from "route -n get default".
+func defaultGateways() []string {
+	out, err := exec.Command("route", "-n", "get", "default").Output()
+	if err != nil {
+		return nil
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "gateway:" {
+			if ip := net.ParseIP(fields[1]); ip != nil && ip.To4() != nil {
+				return []string{ip.String()}
+			}
+		}
+	}
+	return nil
+}
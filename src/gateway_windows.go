@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net"
+	"os/exec"
+	"strings"
+)
+
+// defaultGateways returns the IPv4 gateways of the default routes, parsed
+// from "route print".
+func defaultGateways() []string {
+	out, err := exec.Command("route", "print", "-4", "0.0.0.0").Output()
+	if err != nil {
+		return nil
+	}
+	var gws []string
+	for _, line := range strings.Split(string(out), "\n") {
+		// Network Destination  Netmask  Gateway  Interface  Metric
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && fields[0] == "0.0.0.0" && fields[1] == "0.0.0.0" {
+			if ip := net.ParseIP(fields[2]); ip != nil && ip.To4() != nil {
+				gws = append(gws, ip.String())
+			}
+		}
+	}
+	return gws
+}
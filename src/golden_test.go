@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+// goldenFormats renders the results in every --output format. Formats
+// added to printResults belong here too, each with a checked-in golden
+// file.
+var goldenFormats = map[string]func(t *testing.T, w *bytes.Buffer){
+	"text": func(t *testing.T, w *bytes.Buffer) {
+		w.Write(renderText(t))
+	},
+	"pb": func(t *testing.T, w *bytes.Buffer) {
+		if err := writePB(w, hostResults()); err != nil {
+			t.Fatal(err)
+		}
+	},
+	"ndjson": func(t *testing.T, w *bytes.Buffer) {
+		if err := writeNDJSON(w, hostResults()); err != nil {
+			t.Fatal(err)
+		}
+	},
+	"grep": func(t *testing.T, w *bytes.Buffer) {
+		if err := writeGrep(w, hostResults()); err != nil {
+			t.Fatal(err)
+		}
+	},
+	"csv": func(t *testing.T, w *bytes.Buffer) {
+		if err := writeCSV(w, hostResults()); err != nil {
+			t.Fatal(err)
+		}
+	},
+}
+
+// renderText runs printText and returns what it logged.
+func renderText(t *testing.T) []byte {
+	buf := captureLog(t)
+	printText(log.Default(), hostResults())
+	return buf.Bytes()
+}
+
+// TestGolden renders syntheticScan through every output format, plain
+// and redacted, and compares the result with testdata/golden. Run
+// go test ./src -run TestGolden -update after an intended format change.
+func TestGolden(t *testing.T) {
+	for name, render := range goldenFormats {
+		for _, redacted := range []bool{false, true} {
+			file := name + ".golden"
+			if redacted {
+				file = name + ".redacted.golden"
+			}
+			t.Run(file, func(t *testing.T) {
+				syntheticScan(t)
+				setFlag(t, redact, redacted)
+				setFlag(t, &redactKey, []byte("fixed key so golden files are stable"))
+
+				var got bytes.Buffer
+				render(t, &got)
+				checkGolden(t, filepath.Join("testdata", "golden", file), got.Bytes())
+			})
+		}
+	}
+}
+
+// checkGolden compares got with the golden file at path, or rewrites the
+// file with -update.
+func checkGolden(t *testing.T, path string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%s (run with -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s (run with -update if the change is intended)\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
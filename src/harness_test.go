@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// resetScan clears all scan state held in package globals, so each test
+// starts from an empty result set, and turns off lookups that would leave
+// the machine (reverse DNS).
+func resetScan(t *testing.T) {
+	t.Helper()
+	shards = newShards(4)
+	portResults.Lock()
+	portResults.m = make(map[string][]portResult)
+	portResults.dropped = 0
+	portResults.Unlock()
+	targetNames = make(map[uint32][]string)
+	scanDeadline = time.Time{}
+	report = &scanReport{}
+	setFlag(t, rdns, false)
+	setFlag(t, redact, false)
+}
+
+// setFlag sets a flag variable for the duration of the test.
+func setFlag[T any](t *testing.T, p *T, v T) {
+	t.Helper()
+	old := *p
+	*p = v
+	t.Cleanup(func() { *p = old })
+}
+
+// captureLog redirects the standard logger, which the text output and
+// progress messages go through, into a buffer without timestamps.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	flags, w := log.Flags(), log.Writer()
+	log.SetFlags(0)
+	log.SetOutput(&buf)
+	t.Cleanup(func() {
+		log.SetFlags(flags)
+		log.SetOutput(w)
+	})
+	return &buf
+}
+
+// requireRoot skips tests that need raw sockets or namespaces.
+func requireRoot(t *testing.T) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("skipping privileged scan in -short mode")
+	}
+	if os.Geteuid() != 0 {
+		t.Skip("needs root for raw sockets")
+	}
+}
+
+var netnsSeq int
+
+// netnsHosts creates a network namespace joined to this one by a veth
+// pair and gives its end each of the host addresses, so scans have real
+// synthetic hosts to find. The local end gets localIP. It returns the
+// local interface. Requires root and iproute2 on Linux.
+func netnsHosts(t *testing.T, localIP string, hosts ...string) *net.Interface {
+	t.Helper()
+	requireRoot(t)
+	if _, err := exec.LookPath("ip"); err != nil {
+		t.Skip("needs iproute2 for network namespaces")
+	}
+	// Names are never reused within a run: the net package caches
+	// interface name to index lookups, and a recreated veth gets a new index
+	netnsSeq++
+	id := fmt.Sprintf("%d%d", os.Getpid()%100000, netnsSeq)
+	ns, local, peer := "scli-test-"+id, "sclia"+id, "sclib"+id
+
+	run := func(args ...string) {
+		t.Helper()
+		if out, err := exec.Command("ip", args...).CombinedOutput(); err != nil {
+			t.Skipf("ip %s: %s: %s", strings.Join(args, " "), err, out)
+		}
+	}
+	run("netns", "add", ns)
+	t.Cleanup(func() {
+		exec.Command("ip", "link", "del", local).Run()
+		exec.Command("ip", "netns", "del", ns).Run()
+	})
+	run("link", "add", local, "type", "veth", "peer", "name", peer)
+	run("link", "set", peer, "netns", ns)
+	run("addr", "add", localIP+"/24", "dev", local)
+	run("link", "set", local, "up")
+	for _, h := range hosts {
+		run("-n", ns, "addr", "add", h+"/24", "dev", peer)
+	}
+	run("-n", ns, "link", "set", peer, "up")
+	run("-n", ns, "link", "set", "lo", "up")
+
+	iface, err := net.InterfaceByName(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Wait for the link to come up so the first probes aren't dropped
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if out, _ := os.ReadFile("/sys/class/net/" + local + "/operstate"); strings.TrimSpace(string(out)) == "up" {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return iface
+}
+
+// mustTargets parses target expressions or fails the test.
+func mustTargets(t testing.TB, exprs ...string) targetSet {
+	t.Helper()
+	set, err := parseTargets(exprs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return set
+}
+
+// equalStrings reports whether a and b hold the same strings in order.
+func equalStrings(a, b []string) bool {
+	return strings.Join(a, ",") == strings.Join(b, ",")
+}
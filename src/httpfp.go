@@ -0,0 +1,180 @@
+//go:build !noports
+
+package main
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"html"
+	"io"
+	"math/bits"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+func init() { registerFeature("http-fingerprint") }
+
+// httpsPorts are the web ports fetched over TLS; httpPorts (see banner.go)
+// are fetched in the clear.
+var httpsPorts = map[int]bool{443: true, 4443: true, 8443: true, 9443: true}
+
+// httpBodyMax caps how much of a page is read looking for its title.
+const httpBodyMax = 64 << 10
+
+// httpTextMax caps the length in bytes of a stored title or Server header.
+const httpTextMax = 100
+
+var titleRE = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// fingerprintHTTP fetches / and /favicon.ico from every open web port
+// found and attaches what it learns to the port result.
+func (ps *portScan) fingerprintHTTP() {
+	client := &http.Client{
+		Timeout: 3 * ps.timeout,
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			DialContext:       (&net.Dialer{Timeout: ps.timeout}).DialContext,
+			DisableKeepAlives: true,
+		},
+		// Follow a few redirects (admin pages like to bounce to /login),
+		// but never to another host
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 3 || req.URL.Host != via[0].URL.Host {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}
+	ps.eachOpenTCP(func(ip string, port int) func(*portResult) {
+		scheme := "http"
+		switch {
+		case httpsPorts[port]:
+			scheme = "https"
+		case !httpPorts[port]:
+			return nil
+		}
+		info, err := fetchHTTP(client, scheme+"://"+net.JoinHostPort(ip, strconv.Itoa(port)))
+		if err != nil {
+			return nil
+		}
+		info.Scheme = scheme
+		return func(p *portResult) { p.HTTP = info }
+	})
+}
+
+// fetchHTTP requests base + "/" and base + "/favicon.ico".
+func fetchHTTP(client *http.Client, base string) (*httpInfo, error) {
+	resp, err := client.Get(base + "/")
+	if err != nil {
+		return nil, err
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, httpBodyMax))
+	resp.Body.Close()
+
+	info := &httpInfo{Status: resp.StatusCode, Server: cleanText(resp.Header.Get("Server"), httpTextMax)}
+	if m := titleRE.FindSubmatch(body); m != nil {
+		info.Title = cleanText(html.UnescapeString(string(m[1])), httpTextMax)
+	}
+
+	if icon, err := fetchFavicon(client, base+"/favicon.ico"); err == nil {
+		info.Favicon = strconv.Itoa(int(faviconHash(icon)))
+	}
+	return info, nil
+}
+
+// cleanText makes remote text safe to store and print: invalid UTF-8 is
+// replaced, control characters and runs of whitespace become one space,
+// and the result is cut to at most max bytes on a rune boundary.
+func cleanText(s string, max int) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, strings.ToValidUTF8(s, "\uFFFD"))
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) > max {
+		cut := max
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		s = s[:cut]
+	}
+	return s
+}
+
+func fetchFavicon(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(resp.Status)
+	}
+	icon, err := io.ReadAll(io.LimitReader(resp.Body, httpBodyMax))
+	if err == nil && len(icon) == 0 {
+		err = errors.New("empty favicon")
+	}
+	return icon, err
+}
+
+// faviconHash computes the Shodan-style favicon hash: MurmurHash3 (x86,
+// 32-bit, seed 0) of the icon base64-encoded with a newline every 76
+// characters, as a signed integer.
+func faviconHash(icon []byte) int32 {
+	enc := base64.StdEncoding.EncodeToString(icon)
+	var b strings.Builder
+	for len(enc) > 76 {
+		b.WriteString(enc[:76])
+		b.WriteByte('\n')
+		enc = enc[76:]
+	}
+	b.WriteString(enc)
+	b.WriteByte('\n')
+	return int32(murmur3([]byte(b.String())))
+}
+
+// murmur3 is MurmurHash3_x86_32 with seed 0.
+func murmur3(data []byte) uint32 {
+	const c1, c2 = 0xcc9e2d51, 0x1b873593
+	var h uint32
+	n := len(data) / 4 * 4
+	for i := 0; i < n; i += 4 {
+		k := uint32(data[i]) | uint32(data[i+1])<<8 | uint32(data[i+2])<<16 | uint32(data[i+3])<<24
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+	}
+	var k uint32
+	switch tail := data[n:]; len(tail) {
+	case 3:
+		k ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(tail[0])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+	}
+	h ^= uint32(len(data))
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"io"
+	"net"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// batchWriter is the part of the ICMP socket that icmpSender writes
+// batches to.
+type batchWriter interface {
+	WriteBatch(ms []ipv4.Message, flags int) (int, error)
+}
+
+// icmpSender sends one worker's probes, icmpBatch at a time where the OS
+// can, reusing its packet buffers and destinations across batches.
+type icmpSender struct {
+	c    packetWriter
+	bw   batchWriter
+	dst  []probeAddr
+	bufs [][]byte
+	ms   []ipv4.Message
+}
+
+func newICMPSender(c packetWriter, bw batchWriter) *icmpSender {
+	s := &icmpSender{
+		c:    c,
+		bw:   bw,
+		dst:  make([]probeAddr, icmpBatch),
+		bufs: make([][]byte, icmpBatch),
+		ms:   make([]ipv4.Message, icmpBatch),
+	}
+	for i := range s.ms {
+		s.bufs[i] = make([]byte, 64) // room for the largest probe, a timestamp request
+		s.ms[i].Buffers = make([][]byte, 1)
+	}
+	return s
+}
+
+// send sends an echo request, or a timestamp request, to each of ips, and
+// reports the probes that couldn't be sent.
+func (s *icmpSender) send(ips []uint32, timestamp bool) {
+	if icmpBatch == 1 {
+		for _, ip := range ips {
+			if err := sendICMP(s.c, s.dst[0].set(ip), int(ip), timestamp); err != nil {
+				probeFailed(ip, timestamp, err)
+			}
+		}
+		return
+	}
+
+	now := time.Now()
+	ms := s.ms[:len(ips)]
+	for i, ip := range ips {
+		seq := int(ip)
+		pkt := marshalEcho(s.bufs[i], idBase+seq, seq, now.UnixNano())
+		if timestamp {
+			pkt = marshalTimestamp(s.bufs[i], idBase+seq, seq, msSinceMidnight(now))
+		}
+		ms[i].Buffers[0], ms[i].Addr = pkt, s.dst[i].set(ip)
+	}
+
+	// sendmmsg stops at the first message it can't send: resource errors
+	// are retried like single sends, anything else fails that one probe
+	for attempt := 0; len(ms) > 0; {
+		scanGate.wait()
+		sendLimiter.acquire()
+		engineStats.inFlight.Add(int64(len(ms)))
+		n, err := s.bw.WriteBatch(ms, 0)
+		engineStats.inFlight.Add(-int64(len(ms)))
+		sendLimiter.release()
+		engineStats.sent.Add(int64(n))
+		ms, ips = ms[n:], ips[n:]
+		if n > 0 {
+			attempt = 0
+		}
+		switch {
+		case len(ms) == 0:
+		case err == nil && n == 0:
+			err = io.ErrShortWrite
+			fallthrough
+		case err != nil && (!isResourceError(err) || attempt == 5):
+			engineStats.sendErrors.Add(1)
+			probeFailed(ips[0], timestamp, err)
+			ms, ips = ms[1:], ips[1:]
+			attempt = 0
+		case err != nil:
+			sendLimiter.reduce(err)
+			backoff(attempt)
+			attempt++
+		}
+	}
+}
+
+// probeFailed reports a probe to ip that couldn't be sent.
+func probeFailed(ip uint32, timestamp bool, err error) {
+	if timestamp {
+		scanError("Error sending timestamp request to %s: %s", intToIP(ip), err)
+		return
+	}
+	scanError("Error pinging %s: %s", intToIP(ip), err)
+}
+
+// replyReader reads ICMP replies, icmpBatch per system call where the OS
+// can.
+type replyReader struct {
+	pc  *ipv4.PacketConn
+	raw bool // the socket is raw, so batches start with the IP header
+	ms  []ipv4.Message
+	cm  ipv4.ControlMessage
+}
+
+// newReplyReader asks for the TTL of every reply, which the OS may not
+// report (Windows).
+func newReplyReader(c *icmp.PacketConn) *replyReader {
+	r := &replyReader{pc: c.IPv4PacketConn(), ms: make([]ipv4.Message, icmpBatch)}
+	r.pc.SetControlMessage(ipv4.FlagTTL, true)
+	_, r.raw = r.pc.PacketConn.(*net.IPConn)
+	for i := range r.ms {
+		// Batches from a raw socket keep the IP header, which is read
+		// into a buffer of its own
+		r.ms[i].Buffers = [][]byte{make([]byte, 1500)}
+		if r.raw {
+			r.ms[i].Buffers = [][]byte{make([]byte, ipv4.HeaderLen), r.ms[i].Buffers[0]}
+		}
+		r.ms[i].OOB = ipv4.NewControlMessage(ipv4.FlagTTL)
+	}
+	return r
+}
+
+// read waits for the next replies and calls fn with the sender, TTL (0 if
+// unknown) and ICMP message of each.
+func (r *replyReader) read(fn func(peer net.Addr, ttl int, pkt []byte)) error {
+	if icmpBatch == 1 {
+		b := r.ms[0].Buffers[len(r.ms[0].Buffers)-1]
+		n, cm, peer, err := r.pc.ReadFrom(b)
+		if err != nil {
+			return err
+		}
+		ttl := 0
+		if cm != nil {
+			ttl = cm.TTL
+		}
+		fn(peer, ttl, b[:n])
+		return nil
+	}
+
+	n, err := r.pc.ReadBatch(r.ms, 0)
+	if err != nil {
+		return err
+	}
+	for i := range r.ms[:n] {
+		m := &r.ms[i]
+		var pkt []byte
+		if r.raw {
+			if pkt = ipv4Payload(m.Buffers[0], m.Buffers[1], m.N); pkt == nil {
+				continue
+			}
+		} else {
+			pkt = m.Buffers[0][:m.N]
+		}
+		ttl := 0
+		if m.NN > 0 && r.cm.Parse(m.OOB[:m.NN]) == nil {
+			ttl = r.cm.TTL
+		}
+		fn(m.Addr, ttl, pkt)
+	}
+	return nil
+}
+
+// ipv4Payload returns what follows the IP header of a datagram read as n
+// bytes into hdr, then b, or nil if it's malformed. Header options spill
+// over into b.
+func ipv4Payload(hdr, b []byte, n int) []byte {
+	hlen := int(hdr[0]&0x0f) << 2
+	if n < len(hdr) || hlen < len(hdr) || hlen > n {
+		return nil
+	}
+	return b[hlen-len(hdr) : n-len(hdr)]
+}
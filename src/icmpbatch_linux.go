@@ -0,0 +1,5 @@
+package main
+
+// icmpBatch is how many ICMP messages go to the kernel per system call:
+// sendmmsg and recvmmsg move a whole batch at once.
+const icmpBatch = 32
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package main
+
+// icmpBatch is 1 without sendmmsg and recvmmsg: every ICMP message is
+// sent and received with its own system call.
+const icmpBatch = 1
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"golang.org/x/net/icmp"
+)
+
+// listenICMP opens an ICMP socket in the --icmp mode. raw and dgram are
+// the privileged and unprivileged network names, e.g. "ip4:icmp" and
+// "udp4". In auto mode a permission error on the raw socket falls back
+// to the unprivileged one, which Linux (within net.ipv4.ping_group_range)
+// and macOS allow without root.
+func listenICMP(raw, dgram, addr string) (*icmp.PacketConn, error) {
+	if unprivilegedICMP || *icmpMode == "unprivileged" {
+		unprivilegedICMP = true
+		return icmp.ListenPacket(dgram, addr)
+	}
+	c, err := icmp.ListenPacket(raw, addr)
+	if err == nil || *icmpMode == "raw" || !errors.Is(err, os.ErrPermission) {
+		return c, err
+	}
+
+	log.Printf("No permission for raw ICMP (%s), using unprivileged ICMP sockets", err)
+	c, dgramErr := icmp.ListenPacket(dgram, addr)
+	if dgramErr != nil {
+		return nil, fmt.Errorf("%w; unprivileged ICMP failed too: %v (run as root, or on Linux add your group to net.ipv4.ping_group_range)", err, dgramErr)
+	}
+	unprivilegedICMP = true
+	return c, nil
+}
@@ -0,0 +1,7 @@
+//go:build linux || darwin
+
+package main
+
+// Datagram ICMP sockets ("udp4"), which --icmp unprivileged and the auto
+// fallback use, exist only on Linux and macOS.
+func init() { registerFeature("icmp-unprivileged") }
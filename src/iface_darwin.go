@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net"
+	"os/exec"
+	"strings"
+)
+
+// hiddenInterface reports whether the wizard hides iface unless
+// --all-interfaces is set: Apple Wireless Direct Link and low-latency
+// WLAN interfaces are peer-to-peer only and never worth scanning.
+func hiddenInterface(iface net.Interface) bool {
+	return strings.HasPrefix(iface.Name, "awdl") || strings.HasPrefix(iface.Name, "llw")
+}
+
+// interfaceNotes describes interfaces for the wizard: the hardware port
+// name from networksetup (Wi-Fi, Thunderbolt Bridge, ...) and, for
+// Wi-Fi, the SSID it is joined to.
+func interfaceNotes() map[string]string {
+	out, err := exec.Command("networksetup", "-listallhardwareports").Output()
+	if err != nil {
+		return nil
+	}
+	notes := make(map[string]string)
+	var port string
+	for _, line := range strings.Split(string(out), "\n") {
+		// Hardware Port: Wi-Fi
+		// Device: en0
+		if v, ok := strings.CutPrefix(line, "Hardware Port: "); ok {
+			port = v
+		} else if dev, ok := strings.CutPrefix(line, "Device: "); ok && port != "" {
+			notes[dev] = port
+			if port == "Wi-Fi" {
+				if ssid := wifiSSID(dev); ssid != "" {
+					notes[dev] += ": " + ssid
+				}
+			}
+			port = ""
+		}
+	}
+	return notes
+}
+
+// wifiSSID returns the network the Wi-Fi device dev is joined to.
+func wifiSSID(dev string) string {
+	out, err := exec.Command("ipconfig", "getsummary", dev).Output()
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		//   SSID : HomeNet
+		if k, v, ok := strings.Cut(line, " : "); ok && strings.TrimSpace(k) == "SSID" {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,12 @@
+//go:build !darwin
+
+package main
+
+import "net"
+
+// hiddenInterface reports whether the wizard hides iface unless
+// --all-interfaces is set.
+func hiddenInterface(iface net.Interface) bool { return false }
+
+// interfaceNotes describes interfaces for the wizard, keyed by name.
+func interfaceNotes() map[string]string { return nil }
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+)
+
+// ipv6Wait is how long to collect replies to the multicast pings.
+const ipv6Wait = 3 * time.Second
+
+// ipv6Groups are the link-local multicast groups pinged to find on-link
+// hosts: all nodes and all routers. Sweeping a /64 one address at a time
+// would never finish.
+var ipv6Groups = []string{"ff02::1", "ff02::2"}
+
+// scanIPv6 discovers the IPv6 hosts on iface's link. It pings the
+// all-nodes and all-routers groups, records everyone that answers, then
+// adds every usable entry in the kernel's neighbor discovery cache for
+// iface, with its MAC.
+func scanIPv6(iface *net.Interface) error {
+	c, err := listenICMP("ip6:ipv6-icmp", "udp6", "::")
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	p := c.IPv6PacketConn()
+	if err := p.SetMulticastInterface(iface); err != nil {
+		return fmt.Errorf("selecting %s for multicast: %w", iface.Name, err)
+	}
+	// Only echo replies are of interest; skip the NDP and MLD chatter
+	var filter ipv6.ICMPFilter
+	filter.SetAll(true)
+	filter.Accept(ipv6.ICMPTypeEchoReply)
+	p.SetICMPFilter(&filter)
+
+	log.Printf("Pinging %v on %s", ipv6Groups, iface.Name)
+	for seq := 0; seq < 2; seq++ { // twice, in case the first is lost
+		for _, group := range ipv6Groups {
+			msg, _ := (&icmp.Message{
+				Type: ipv6.ICMPTypeEchoRequest,
+				Body: &icmp.Echo{ID: idBase, Seq: seq, Data: echoPayload},
+			}).Marshal(nil) // the kernel fills in the ICMPv6 checksum
+			var dst net.Addr = &net.IPAddr{IP: net.ParseIP(group), Zone: iface.Name}
+			if unprivilegedICMP {
+				dst = &net.UDPAddr{IP: net.ParseIP(group), Zone: iface.Name}
+			}
+			if _, err := c.WriteTo(msg, dst); err != nil {
+				return fmt.Errorf("pinging %s: %w", group, err)
+			}
+		}
+	}
+
+	c.SetReadDeadline(time.Now().Add(ipv6Wait))
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := c.ReadFrom(buf)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				break
+			}
+			return err
+		}
+		msg, err := icmp.ParseMessage(58, buf[:n])
+		if err != nil || msg.Type != ipv6.ICMPTypeEchoReply {
+			continue
+		}
+		add(peerIPv6(peer), "icmpv6")
+	}
+
+	for ip, mac := range neighbors6(iface.Name) {
+		recordMAC(ip, mac)
+		add(ip, "ndp")
+	}
+	return nil
+}
+
+// peerIPv6 returns the address of an ICMPv6 peer without its zone or port.
+func peerIPv6(addr net.Addr) string {
+	switch a := addr.(type) {
+	case *net.IPAddr:
+		return a.IP.String()
+	case *net.UDPAddr:
+		return a.IP.String()
+	}
+	return addr.String()
+}
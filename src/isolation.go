@@ -0,0 +1,76 @@
+package main
+
+import (
+	"log"
+	"net"
+	"slices"
+	"strings"
+)
+
+// isolationLeaks returns the responding hosts that should have been
+// unreachable if client isolation works: anything other than this host's
+// own addresses and its default gateways.
+func isolationLeaks(found []string) []string {
+	allowed := make(map[string]bool)
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ip, _, err := net.ParseCIDR(addr.String()); err == nil {
+				allowed[ip.String()] = true
+			}
+		}
+	}
+	for _, gw := range defaultGateways() {
+		allowed[gw] = true
+	}
+
+	var leaks []string
+	for _, ip := range found {
+		if !allowed[ip] {
+			leaks = append(leaks, ip)
+		}
+	}
+	return leaks
+}
+
+// isolationMethods adds the discovery methods an --isolation-test always
+// runs to methods: ICMP, TCP ping and, where this build and platform can
+// send it, ARP.
+func isolationMethods(methods map[string]bool) map[string]bool {
+	methods["icmp"] = true
+	methods["tcp"] = true
+	if featureEnabled("arp") && !termuxMode {
+		methods["arp"] = true
+	}
+	return methods
+}
+
+// methodNames spells discovery methods the way reports name protocols.
+var methodNames = map[string]string{
+	"arp": "ARP", "icmp": "ICMP", "timestamp": "ICMP timestamp", "tcp": "TCP",
+	"udp": "UDP", "mdns": "mDNS", "icmpv6": "ICMPv6", "ndp": "NDP",
+}
+
+// reportIsolation logs the outcome of an --isolation-test run and reports
+// whether isolation held.
+func reportIsolation(found []string) bool {
+	leaks := isolationLeaks(found)
+	if len(leaks) == 0 {
+		log.Printf("Client isolation OK: no peers answered")
+		return true
+	}
+	var over []string
+	for _, ip := range leaks {
+		name := methodNames[foundBy(ip)]
+		if name == "" {
+			name = foundBy(ip)
+		}
+		if !slices.Contains(over, name) {
+			over = append(over, name)
+		}
+	}
+	log.Printf("Client isolation FAILED: %d peers reachable over %s", len(leaks), strings.Join(over, ", "))
+	for _, ip := range leaks {
+		log.Printf("  leak: %s (via %s)", display(ip), foundBy(ip))
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// reduceWindow is how long one reduction covers: errors from probes
+	// already in flight when the limit was halved don't halve it again.
+	reduceWindow = 100 * time.Millisecond
+	// recoverAfter is how long sends must go without resource errors
+	// before the limit grows back by one step.
+	recoverAfter = time.Second
+)
+
+// limiter caps how many probes are being sent at once. The cap starts at
+// --concurrency, is halved at most once per reduceWindow while the OS
+// signals resource exhaustion, and grows back additively, by a sixteenth
+// of the starting cap per recoverAfter without errors.
+type limiter struct {
+	mu         sync.Mutex
+	cond       *sync.Cond
+	limit      int
+	max        int
+	inFlight   int
+	lastReduce time.Time // when the limit was last halved
+	quietSince time.Time // last resource error or recovery step
+}
+
+func newLimiter(limit int) *limiter {
+	if limit < 1 {
+		limit = 1
+	}
+	l := &limiter{limit: limit, max: limit}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+func (l *limiter) acquire() {
+	l.mu.Lock()
+	for l.inFlight >= l.limit {
+		l.cond.Wait()
+	}
+	l.inFlight++
+	l.mu.Unlock()
+}
+
+func (l *limiter) release() {
+	l.mu.Lock()
+	l.inFlight--
+	grew := l.grow()
+	l.mu.Unlock()
+	if grew {
+		l.cond.Broadcast()
+	} else {
+		l.cond.Signal()
+	}
+}
+
+// grow raises a reduced limit by one step once recoverAfter has passed
+// since the last error or step, and reports whether it did. l.mu must be
+// held.
+func (l *limiter) grow() bool {
+	if l.limit >= l.max {
+		return false
+	}
+	now := scanClock.Now()
+	if now.Sub(l.quietSince) < recoverAfter {
+		return false
+	}
+	l.limit = min(l.limit+max(l.max/16, 1), l.max)
+	l.quietSince = now
+	return true
+}
+
+// current returns the limit now in force.
+func (l *limiter) current() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// reduce halves the limit in response to err, down to a minimum of one.
+// A burst of failures within reduceWindow counts as one.
+func (l *limiter) reduce(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := scanClock.Now()
+	l.quietSince = now
+	if l.limit == 1 || (!l.lastReduce.IsZero() && now.Sub(l.lastReduce) < reduceWindow) {
+		return
+	}
+	l.limit /= 2
+	l.lastReduce = now
+	scanWarning("Reducing send concurrency to %d after: %s", l.limit, err)
+}
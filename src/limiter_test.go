@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// One ENOBUFS spike seen by every worker at once halves the limit once,
+// and the limit climbs back once sends stop failing.
+func TestLimiterConcurrentFailures(t *testing.T) {
+	resetScan(t)
+	captureLog(t)
+	c := useFakeClock(t)
+	l := newLimiter(256)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.reduce(errors.New("no buffer space available"))
+		}()
+	}
+	wg.Wait()
+	if l.limit != 128 {
+		t.Fatalf("limit after one burst = %d, want 128", l.limit)
+	}
+
+	c.advance(reduceWindow)
+	l.reduce(errors.New("no buffer space available"))
+	if l.limit != 64 {
+		t.Fatalf("limit after a second burst = %d, want 64", l.limit)
+	}
+
+	for want := 64 + 16; want <= 256; want += 16 {
+		c.advance(recoverAfter)
+		l.acquire()
+		l.release()
+		if l.limit != want {
+			t.Fatalf("limit after recovering = %d, want %d", l.limit, want)
+		}
+	}
+	c.advance(time.Hour)
+	l.acquire()
+	l.release()
+	if l.limit != 256 {
+		t.Errorf("limit grew past --concurrency to %d", l.limit)
+	}
+	if report.warningCount != 2 {
+		t.Errorf("%d reduction warnings, want 2", report.warningCount)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"math"
+	"runtime/debug"
+)
+
+// Defaults used by --low-memory, sized for 64-128MB router-class devices.
+const (
+	lowMemConcurrency     = 32
+	lowMemPortConcurrency = 16
+	lowMemRDNS            = 4
+	lowMemSockBuf         = 64 << 10
+	lowMemLimit           = 48 << 20 // soft heap limit for the Go runtime
+)
+
+// applyLowMemory lowers the defaults of every flag the user didn't set
+// and asks the runtime to collect garbage before the heap grows large.
+func applyLowMemory() {
+	if !flagSet(flag.CommandLine, "concurrency") {
+		*concurrency = lowMemConcurrency
+	}
+	if !flagSet(flag.CommandLine, "rdns-concurrency") {
+		*rdnsConcurrency = lowMemRDNS
+	}
+	if !flagSet(flag.CommandLine, "sndbuf") {
+		*sndbuf = lowMemSockBuf
+	}
+	if !flagSet(flag.CommandLine, "rcvbuf") {
+		*rcvbuf = lowMemSockBuf
+	}
+	// An explicit GOMEMLIMIT in the environment takes precedence
+	if debug.SetMemoryLimit(-1) == math.MaxInt64 {
+		debug.SetMemoryLimit(lowMemLimit)
+	}
+}
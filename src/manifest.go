@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"runtime"
+	"time"
+)
+
+// manifest records how a scan was run so its results can be interpreted later.
+type manifest struct {
+	SchemaVersion int               `json:"schema_version"`
+	Tool          string            `json:"tool"`
+	Version       string            `json:"version"`
+	Revision      string            `json:"revision,omitempty"`
+	GoVersion     string            `json:"go_version"`
+	OS            string            `json:"os"`
+	Arch          string            `json:"arch"`
+	Hostname      string            `json:"hostname,omitempty"`
+	Args          []string          `json:"args"`
+	Flags         map[string]string `json:"flags"`
+	Targets       string            `json:"targets"`
+	StartedAt     time.Time         `json:"started_at"`
+	FinishedAt    time.Time         `json:"finished_at"`
+	HostsFound    int               `json:"hosts_found"`
+	Unprobed      int64             `json:"unprobed"`
+	OUI           *ouiTable         `json:"oui,omitempty"` // table vendor names came from
+	// Partial is set when hosts may be missing: targets were left
+	// unprobed or probes failed. Errors and Warnings hold the first
+	// messages of each kind, with the totals alongside.
+	Partial      bool     `json:"partial"`
+	Errors       []string `json:"errors,omitempty"`
+	ErrorCount   int      `json:"error_count,omitempty"`
+	Warnings     []string `json:"warnings,omitempty"`
+	WarningCount int      `json:"warning_count,omitempty"`
+}
+
+// newManifest captures the tool build and environment for the current run.
+func newManifest(targets string, started time.Time) *manifest {
+	mf := &manifest{
+		SchemaVersion: manifestVersion,
+		Tool:          "scli",
+		GoVersion:     runtime.Version(),
+		OS:            runtime.GOOS,
+		Arch:          runtime.GOARCH,
+		Args:          append([]string(nil), os.Args[1:]...),
+		Flags:         make(map[string]string),
+		Targets:       targets,
+		StartedAt:     started,
+		OUI:           embeddedOUI(),
+	}
+	mf.Version, mf.Revision = buildVersion()
+	mf.Hostname, _ = os.Hostname()
+	flag.Visit(func(f *flag.Flag) {
+		mf.Flags[f.Name] = f.Value.String()
+	})
+	if *redact {
+		mf.redact()
+	}
+	return mf
+}
+
+// redact pseudonymizes the hosts the manifest names, as --redact does for
+// the results: the targets, the command line and the scanning machine.
+func (mf *manifest) redact() {
+	mf.Targets = redactText(mf.Targets)
+	if mf.Hostname != "" {
+		mf.Hostname = redactName(mf.Hostname)
+	}
+	for i, arg := range mf.Args {
+		mf.Args[i] = redactText(arg)
+	}
+	for name, value := range mf.Flags {
+		mf.Flags[name] = redactText(value)
+	}
+}
+
+// addReport copies the scan's errors and warnings into the manifest.
+func (mf *manifest) addReport(r *scanReport) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	mf.Partial = mf.Unprobed > 0 || r.errorCount > 0
+	mf.Errors, mf.ErrorCount = r.errors, r.errorCount
+	mf.Warnings, mf.WarningCount = r.warnings, r.warningCount
+}
+
+// marshal renders the manifest as indented JSON.
+func (mf *manifest) marshal() ([]byte, error) {
+	b, err := json.MarshalIndent(mf, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// write saves the manifest to path.
+func (mf *manifest) write(path string) error {
+	b, err := mf.marshal()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, b, 0o644)
+}
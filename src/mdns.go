@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"time"
+)
+
+// mdnsWait is how long to collect multicast DNS answers.
+const mdnsWait = 2 * time.Second
+
+// mdnsGroup is the IPv4 multicast DNS address.
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// scanMDNS asks the local segment for its DNS-SD services and records
+// every target that answers. Phones, printers and media devices often
+// ignore pings but respond to mDNS.
+func scanMDNS(targets targetSet) error {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Ask for unicast replies (the QU bit) so they come back to our port
+	q := dnsQuery("_services._dns-sd._udp.local", 12)
+	binary.BigEndian.PutUint16(q[0:], 0) // mDNS queries carry ID 0
+	binary.BigEndian.PutUint16(q[2:], 0) // and no flags
+	binary.BigEndian.PutUint16(q[len(q)-2:], 0x8001)
+	if _, err := conn.WriteToUDP(q, mdnsGroup); err != nil {
+		return err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(mdnsWait))
+	buf := make([]byte, 9000)
+	for {
+		_, peer, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				return nil
+			}
+			return err
+		}
+		v4 := peer.IP.To4()
+		if v4 == nil || !targets.contains(ipToInt(v4.String())) {
+			continue
+		}
+		add(v4.String(), "mdns")
+	}
+}
+
+// dnsQuery builds a recursive DNS query for name with the given qtype.
+func dnsQuery(name string, qtype uint16) []byte {
+	b := []byte{0x13, 0x37, 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0}
+	start := 0
+	for i := 0; i <= len(name); i++ {
+		if i == len(name) || name[i] == '.' {
+			if label := name[start:i]; label != "" {
+				b = append(b, byte(len(label)))
+				b = append(b, label...)
+			}
+			start = i + 1
+		}
+	}
+	b = append(b, 0)
+	b = binary.BigEndian.AppendUint16(b, qtype)
+	return binary.BigEndian.AppendUint16(b, 1) // class IN
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net"
+	"os/exec"
+	"strings"
+)
+
+// neighbors6 returns the IPv6 neighbor discovery cache for iface, parsed
+// from "ip -6 neigh", keyed by IP.
+func neighbors6(iface string) map[string]net.HardwareAddr {
+	out, err := exec.Command("ip", "-6", "neigh", "show", "dev", iface).Output()
+	if err != nil {
+		return nil
+	}
+	table := make(map[string]net.HardwareAddr)
+	for _, line := range strings.Split(string(out), "\n") {
+		// fe80::1 lladdr 02:fc:00:00:00:05 router REACHABLE
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[1] != "lladdr" {
+			continue // INCOMPLETE and FAILED entries have no lladdr
+		}
+		if mac, err := net.ParseMAC(fields[2]); err == nil {
+			table[fields[0]] = mac
+		}
+	}
+	return table
+}
@@ -0,0 +1,31 @@
+//go:build !linux && !windows
+
+package main
+
+import (
+	"net"
+	"os/exec"
+	"strings"
+)
+
+// neighbors6 returns the IPv6 neighbor discovery cache for iface, parsed
+// from "ndp -an", keyed by IP.
+func neighbors6(iface string) map[string]net.HardwareAddr {
+	out, err := exec.Command("ndp", "-an").Output()
+	if err != nil {
+		return nil
+	}
+	table := make(map[string]net.HardwareAddr)
+	for _, line := range strings.Split(string(out), "\n") {
+		// fe80::1%en0   0:1b:63:84:45:e6   en0 23h59m58s S R
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[2] != iface {
+			continue
+		}
+		ip, _, _ := strings.Cut(fields[0], "%")
+		if mac, err := parseLooseMAC(fields[1]); err == nil && net.ParseIP(ip) != nil {
+			table[ip] = mac
+		}
+	}
+	return table
+}
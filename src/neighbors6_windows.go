@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net"
+	"os/exec"
+	"strings"
+)
+
+// neighbors6 returns the IPv6 neighbor cache for iface, parsed from
+// "netsh interface ipv6 show neighbors", keyed by IP.
+func neighbors6(iface string) map[string]net.HardwareAddr {
+	out, err := exec.Command("netsh", "interface", "ipv6", "show", "neighbors", "interface="+iface).Output()
+	if err != nil {
+		return nil
+	}
+	table := make(map[string]net.HardwareAddr)
+	for _, line := range strings.Split(string(out), "\n") {
+		// fe80::1                                   02-fc-00-00-00-05  Reachable (Router)
+		fields := strings.Fields(line)
+		if len(fields) < 3 || strings.HasPrefix(fields[2], "Unreachable") {
+			continue
+		}
+		ip := net.ParseIP(fields[0])
+		if ip == nil || ip.To4() != nil || ip.IsMulticast() {
+			continue
+		}
+		mac, err := net.ParseMAC(fields[1])
+		if err != nil || mac.String() == "00:00:00:00:00:00" {
+			continue
+		}
+		table[ip.String()] = mac
+	}
+	return table
+}
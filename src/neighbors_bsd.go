@@ -0,0 +1,39 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+
+package main
+
+import (
+	"net"
+	"syscall"
+
+	"golang.org/x/net/route"
+)
+
+// neighbors returns the IPv4 neighbor (ARP) table, read from the kernel's
+// routing table through sysctl, keyed by IP.
+func neighbors() map[string]net.HardwareAddr {
+	rib, err := route.FetchRIB(syscall.AF_INET, syscall.NET_RT_FLAGS, syscall.RTF_LLINFO)
+	if err != nil {
+		return nil
+	}
+	msgs, err := route.ParseRIB(syscall.NET_RT_FLAGS, rib)
+	if err != nil {
+		return nil
+	}
+	table := make(map[string]net.HardwareAddr)
+	for _, m := range msgs {
+		rm, ok := m.(*route.RouteMessage)
+		if !ok || len(rm.Addrs) <= syscall.RTAX_GATEWAY {
+			continue
+		}
+		dst, ok := rm.Addrs[syscall.RTAX_DST].(*route.Inet4Addr)
+		if !ok {
+			continue
+		}
+		// Incomplete entries have no link-layer address yet
+		if link, ok := rm.Addrs[syscall.RTAX_GATEWAY].(*route.LinkAddr); ok && len(link.Addr) == 6 {
+			table[net.IP(dst.IP[:]).String()] = net.HardwareAddr(link.Addr)
+		}
+	}
+	return table
+}
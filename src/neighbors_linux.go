@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"strings"
+)
+
+// neighbors returns the kernel's IPv4 neighbor (ARP) table from
+// /proc/net/arp, keyed by IP.
+func neighbors() map[string]net.HardwareAddr {
+	f, err := os.Open("/proc/net/arp")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	return parseARPTable(f)
+}
+
+// parseARPTable reads a neighbor table in the format of /proc/net/arp,
+// leaving out incomplete entries.
+func parseARPTable(r io.Reader) map[string]net.HardwareAddr {
+	table := make(map[string]net.HardwareAddr)
+	sc := bufio.NewScanner(r)
+	sc.Scan() // header
+	for sc.Scan() {
+		// IP address  HW type  Flags  HW address  Mask  Device
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 4 || fields[2] == "0x0" {
+			continue // incomplete entry
+		}
+		if mac, err := net.ParseMAC(fields[3]); err == nil {
+			table[fields[0]] = mac
+		}
+	}
+	return table
+}
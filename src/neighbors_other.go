@@ -0,0 +1,31 @@
+//go:build !linux && !windows && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+
+package main
+
+import (
+	"net"
+	"os/exec"
+	"strings"
+)
+
+// neighbors returns the IPv4 neighbor (ARP) table, parsed from "arp -an",
+// keyed by IP.
+func neighbors() map[string]net.HardwareAddr {
+	out, err := exec.Command("arp", "-an").Output()
+	if err != nil {
+		return nil
+	}
+	table := make(map[string]net.HardwareAddr)
+	for _, line := range strings.Split(string(out), "\n") {
+		// ? (192.168.1.1) at 0:1b:63:84:45:e6 on en0 ifscope [ethernet]
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[2] != "at" {
+			continue
+		}
+		ip := strings.Trim(fields[1], "()")
+		if mac, err := parseLooseMAC(fields[3]); err == nil {
+			table[ip] = mac
+		}
+	}
+	return table
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net"
+	"os/exec"
+	"strings"
+)
+
+// neighbors returns the IPv4 neighbor (ARP) table, parsed from "arp -a",
+// keyed by IP.
+func neighbors() map[string]net.HardwareAddr {
+	out, err := exec.Command("arp", "-a").Output()
+	if err != nil {
+		return nil
+	}
+	table := make(map[string]net.HardwareAddr)
+	for _, line := range strings.Split(string(out), "\n") {
+		// Internet Address  Physical Address  Type
+		fields := strings.Fields(line)
+		if len(fields) < 3 || net.ParseIP(fields[0]) == nil {
+			continue
+		}
+		if mac, err := net.ParseMAC(fields[1]); err == nil {
+			table[fields[0]] = mac
+		}
+	}
+	return table
+}
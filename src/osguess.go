@@ -0,0 +1,42 @@
+package main
+
+import "fmt"
+
+// initialTTLs are the starting TTLs common operating systems use, with
+// the family each one usually indicates.
+var initialTTLs = []struct {
+	ttl    int
+	family string
+}{
+	{32, "Windows 9x/embedded"},
+	{64, "Linux/Unix/macOS"},
+	{128, "Windows"},
+	{255, "network device"},
+}
+
+// guessOS maps the TTL of a reply to a rough OS family, assuming the
+// sender started from the nearest common initial TTL at or above it, and
+// counts the hops in between. It is a hint, not a fingerprint: the TTL is
+// configurable and middleboxes can rewrite it.
+func guessOS(ttl int) (family string, hops int) {
+	for _, t := range initialTTLs {
+		if ttl <= t.ttl {
+			return t.family, t.ttl - ttl
+		}
+	}
+	return "", 0
+}
+
+// describeTTL renders a reply TTL with its OS guess, e.g.
+// "ttl 63: Linux/Unix/macOS, 1 hop".
+func describeTTL(ttl int) string {
+	family, hops := guessOS(ttl)
+	if family == "" {
+		return fmt.Sprintf("ttl %d", ttl)
+	}
+	unit := "hops"
+	if hops == 1 {
+		unit = "hop"
+	}
+	return fmt.Sprintf("ttl %d: %s, %d %s", ttl, family, hops, unit)
+}
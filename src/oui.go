@@ -0,0 +1,67 @@
+package main
+
+import (
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"net"
+	"strings"
+)
+
+//go:embed oui.txt
+var ouiData string
+
+// ouiVendors maps the upper-case hex OUI (e.g. "B827EB") to its vendor.
+var ouiVendors = parseOUI(ouiData)
+
+// ouiTable identifies the embedded OUI table in a manifest, so vendor
+// names in old results can be traced to the table that produced them.
+type ouiTable struct {
+	Entries int    `json:"entries"`
+	SHA256  string `json:"sha256"`
+}
+
+// embeddedOUI describes the OUI table built into this binary.
+func embeddedOUI() *ouiTable {
+	sum := sha256.Sum256([]byte(ouiData))
+	return &ouiTable{Entries: len(ouiVendors), SHA256: hex.EncodeToString(sum[:])}
+}
+
+func parseOUI(data string) map[string]string {
+	vendors := make(map[string]string)
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		prefix, vendor, ok := strings.Cut(line, " ")
+		if ok {
+			vendors[strings.ToUpper(prefix)] = strings.TrimSpace(vendor)
+		}
+	}
+	return vendors
+}
+
+// macVendor returns the manufacturer for mac, or "" if it isn't known.
+// Locally administered (e.g. randomized) addresses have no vendor.
+func macVendor(mac net.HardwareAddr) string {
+	if len(mac) < 3 {
+		return ""
+	}
+	if mac[0]&0x02 != 0 {
+		return "locally administered"
+	}
+	return ouiVendors[strings.ToUpper(strings.ReplaceAll(mac[:3].String(), ":", ""))]
+}
+
+// parseLooseMAC parses a MAC whose octets may lack leading zeros, as BSD
+// arp prints them.
+func parseLooseMAC(s string) (net.HardwareAddr, error) {
+	parts := strings.Split(s, ":")
+	for i, p := range parts {
+		if len(p) == 1 {
+			parts[i] = "0" + p
+		}
+	}
+	return net.ParseMAC(strings.Join(parts, ":"))
+}
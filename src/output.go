@@ -0,0 +1,467 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// hostResult is one live host as presented in the output.
+type hostResult struct {
+	IP       string
+	Name     string // hostname the target was given as, if any
+	Hostname string // PTR name from reverse DNS, if any
+	MAC      string // from the neighbor table, for on-link hosts
+	Vendor   string // manufacturer looked up from the MAC's OUI
+	Gateway  bool
+	AdminURL string        // gateway web interface found by --http, if any
+	TTL      int           // IP TTL of the echo reply, 0 if unknown
+	OS       string        // OS family guessed from the TTL
+	Method   string        // discovery method that found the host
+	RTT      time.Duration // round-trip time of the fastest reply, 0 if not measured
+	Ports    []portResult  // port states from "scli ports"
+}
+
+// replaying is set while printing the results of "scli replay", which
+// describe the recorded network, not the one this machine is on now.
+var replaying bool
+
+// hostResults returns the scan results in order, ready for output. On
+// replay, the gateways, reverse DNS and neighbor table of the network
+// scli now runs on are left out.
+func hostResults() []hostResult {
+	ips := results()
+	gateways := make(map[string]bool)
+	var ptrs map[string]string
+	var arp map[string]net.HardwareAddr
+	if !replaying {
+		for _, gw := range defaultGateways() {
+			gateways[gw] = true
+		}
+		if *rdns {
+			ptrs = lookupHostnames(ips, *rdnsConcurrency, *rdnsTimeout)
+		}
+		arp = neighbors()
+	}
+
+	var hosts []hostResult
+	for _, ip := range ips {
+		h := hostResult{IP: display(ip), Gateway: gateways[ip], Method: foundBy(ip), RTT: scannedRTT(ip), Ports: hostPorts(ip)}
+		if names := targetNames[ipToInt(ip)]; len(names) > 0 {
+			h.Name = displayName(strings.Join(names, ","))
+		}
+		if ptr := ptrs[ip]; ptr != "" {
+			h.Hostname = displayName(ptr)
+		}
+		if h.TTL = scannedTTL(ip); h.TTL > 0 {
+			h.OS, _ = guessOS(h.TTL)
+		}
+		mac := scannedMAC(ip)
+		if mac == nil {
+			mac = arp[ip]
+		}
+		if mac != nil {
+			h.MAC = displayMAC(mac)
+			h.Vendor = macVendor(mac)
+		}
+		if h.Gateway {
+			h.AdminURL = adminURL(h.IP, h.Ports)
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts
+}
+
+// adminURL returns the URL of the first web page --http fetched from
+// ports on host, which on a gateway is most likely its admin interface.
+func adminURL(host string, ports []portResult) string {
+	for _, p := range ports {
+		if p.HTTP != nil && p.HTTP.Scheme != "" {
+			return p.HTTP.Scheme + "://" + net.JoinHostPort(host, strconv.Itoa(p.Port))
+		}
+	}
+	return ""
+}
+
+// printResults writes the results in the --output format, to stdout or,
+// with -o, to a file that is only replaced once it is complete.
+func printResults() {
+	hosts := hostResults()
+	if *outFile == "" {
+		if err := writeResults(os.Stdout, log.Default(), hosts); err != nil {
+			log.Fatalf("Error writing results: %s", err)
+		}
+		return
+	}
+	var buf bytes.Buffer
+	if err := writeResults(&buf, log.New(&buf, "", 0), hosts); err != nil {
+		log.Fatalf("Error writing results: %s", err)
+	}
+	if err := writeFileAtomic(*outFile, buf.Bytes(), 0o644); err != nil {
+		log.Fatalf("Error writing results to %s: %s", *outFile, err)
+	}
+	log.Printf("Wrote %s to %s", plural(len(hosts), "host"), *outFile)
+}
+
+// writeResults writes hosts to w in the --output format. Text output goes
+// to l instead, which logs to stderr unless writing to a file.
+func writeResults(w io.Writer, l *log.Logger, hosts []hostResult) error {
+	switch *output {
+	case "pb":
+		return writePB(w, hosts)
+	case "csv":
+		return writeCSV(w, hosts)
+	case "ndjson":
+		return writeNDJSON(w, hosts)
+	case "grep":
+		return writeGrep(w, hosts)
+	default:
+		printText(l, hosts)
+		return nil
+	}
+}
+
+// outputExtensions maps file extensions to the --output format -o infers
+// from them. JSON files get NDJSON, one object per line.
+var outputExtensions = map[string]string{
+	".txt":    "text",
+	".log":    "text",
+	".pb":     "pb",
+	".csv":    "csv",
+	".json":   "ndjson",
+	".ndjson": "ndjson",
+	".jsonl":  "ndjson",
+	".gnmap":  "grep",
+	".grep":   "grep",
+}
+
+// formatForPath infers the output format from the extension of path.
+func formatForPath(path string) (string, error) {
+	if format, ok := outputExtensions[strings.ToLower(filepath.Ext(path))]; ok {
+		return format, nil
+	}
+	return "", fmt.Errorf("can't tell the output format of %s from its extension, use --format", path)
+}
+
+// printText logs the unique IPs found, in order, to l.
+func printText(l *log.Logger, hosts []hostResult) {
+	l.Printf("Unique IPs: %v", len(hosts))
+	l.Println("List of IPs in order:")
+	for _, h := range hosts {
+		line := h.IP
+		if h.Name != "" {
+			line += " (" + h.Name + ")"
+		}
+		if h.Hostname != "" && h.Hostname != h.Name {
+			line += " (" + h.Hostname + ")"
+		}
+		if h.MAC != "" {
+			line += " " + h.MAC
+		}
+		if h.Vendor != "" {
+			line += " [" + h.Vendor + "]"
+		}
+		switch {
+		case h.AdminURL != "":
+			line += " (gateway, admin " + h.AdminURL + ")"
+		case h.Gateway:
+			line += " (gateway)"
+		}
+		if h.TTL > 0 {
+			line += " (" + describeTTL(h.TTL) + ")"
+		}
+		if h.Method != "" {
+			line += " (via " + h.Method + ")"
+		}
+		l.Println(line)
+		printPorts(l, h.Ports)
+	}
+	if n := droppedPorts(); n > 0 {
+		l.Printf("%d closed or filtered ports not kept (--low-memory)", n)
+	}
+}
+
+// printPorts logs each open port to l, then a count of the rest by state.
+func printPorts(l *log.Logger, ports []portResult) {
+	if len(ports) == 0 {
+		return
+	}
+	closed, filtered := 0, 0
+	for _, p := range ports {
+		switch p.State {
+		case portOpen:
+			line := fmt.Sprintf("    %d/%s open", p.Port, p.Proto)
+			switch {
+			case p.Service != "":
+				line += " " + p.Service
+				if p.Version != "" {
+					line += " " + p.Version
+				}
+			case serviceName(p.Port, p.Proto) != "":
+				line += " " + serviceName(p.Port, p.Proto)
+			}
+			if p.Service == "" && p.Banner != "" && !*redact {
+				line += fmt.Sprintf(" %q", p.Banner)
+			}
+			l.Println(line)
+			if c := p.Cert; c != nil {
+				expiry, soon := certExpiry(c.NotAfter, certWarn)
+				if soon {
+					expiry = "!! " + expiry
+				}
+				l.Printf("      cert %s, issuer %s, %s", displayName(c.Subject), displayName(c.Issuer), expiry)
+				if len(c.SANs) > 0 {
+					l.Printf("      SANs %s", sanList(c.SANs))
+				}
+			}
+			if w := p.HTTP; w != nil {
+				line := "      http " + strconv.Itoa(w.Status)
+				if w.Server != "" {
+					line += " " + w.Server
+				}
+				if w.Title != "" && !*redact {
+					line += fmt.Sprintf(" %q", w.Title)
+				}
+				if w.Favicon != "" {
+					line += " favicon " + w.Favicon
+				}
+				l.Println(line)
+			}
+		case portClosed:
+			closed++
+		default:
+			filtered++
+		}
+	}
+	if closed > 0 || filtered > 0 {
+		l.Printf("    (%d closed, %d filtered)", closed, filtered)
+	}
+}
+
+// csvHeader is the column set of --output csv. Columns are only ever
+// added at the end, so spreadsheets and imports keyed on them keep working.
+var csvHeader = []string{"ip", "hostname", "mac", "vendor", "rtt_ms", "method"}
+
+// writeCSV writes hosts as CSV with a header row. The hostname is the PTR
+// name, or the name the target was given as when there is none; rtt_ms
+// is empty where no round-trip time was measured (ARP, SYN pings) or it
+// was below the millisecond resolution of ICMP timestamps.
+func writeCSV(w io.Writer, hosts []hostResult) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+	for _, h := range hosts {
+		hostname := h.Hostname
+		if hostname == "" {
+			hostname = h.Name
+		}
+		rtt := ""
+		if h.RTT > 0 {
+			rtt = strconv.FormatFloat(float64(h.RTT)/float64(time.Millisecond), 'f', 3, 64)
+		}
+		cw.Write([]string{h.IP, csvText(hostname), h.MAC, csvText(h.Vendor), rtt, h.Method})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvText defuses text that a spreadsheet would run as a formula, such
+// as a hostile PTR name starting with "=", by prefixing a quote.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// writeGrep writes one line per host of tab-separated "Key: value"
+// fields, after nmap's -oG, so results can be counted and filtered with
+// grep, cut and awk. Empty fields are left out. Ports are comma-separated
+// port/state/proto//service//version/ entries, with any "/" or "," inside
+// a field replaced by "|".
+func writeGrep(w io.Writer, hosts []hostResult) error {
+	bw := bufio.NewWriter(w)
+	for _, h := range hosts {
+		hostname := h.Hostname
+		if hostname == "" {
+			hostname = h.Name
+		}
+		fields := []string{"Host: " + h.IP + " (" + grepText(hostname) + ")", "Status: Up"}
+		field := func(key, value string) {
+			if value != "" {
+				fields = append(fields, key+": "+grepText(value))
+			}
+		}
+		field("MAC", h.MAC)
+		field("Vendor", h.Vendor)
+		if h.Gateway {
+			field("Gateway", "yes")
+		}
+		field("Admin", h.AdminURL)
+		if h.TTL > 0 {
+			field("TTL", strconv.Itoa(h.TTL))
+		}
+		field("OS", h.OS)
+		if h.RTT > 0 {
+			field("RTT", strconv.FormatFloat(rttMillis(h.RTT), 'f', 3, 64)+"ms")
+		}
+		field("Method", h.Method)
+		var ports []string
+		for _, p := range h.Ports {
+			service := p.Service
+			if service == "" {
+				service = serviceName(p.Port, p.Proto)
+			}
+			ports = append(ports, fmt.Sprintf("%d/%s/%s//%s//%s/", p.Port, p.State, p.Proto, grepPortText(service), grepPortText(p.Version)))
+		}
+		if len(ports) > 0 {
+			fields = append(fields, "Ports: "+strings.Join(ports, ", "))
+		}
+		bw.WriteString(strings.Join(fields, "\t") + "\n")
+	}
+	return bw.Flush()
+}
+
+// grepText keeps a value on its line and in its field by turning tabs
+// and newlines into spaces.
+func grepText(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' {
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+// grepPortText escapes the separators of a Ports entry in s.
+func grepPortText(s string) string {
+	return strings.NewReplacer("/", "|", ",", "|").Replace(grepText(s))
+}
+
+// writePB writes hosts as length-delimited scli.Host protobuf messages
+// (see proto/scli.proto).
+func writePB(w io.Writer, hosts []hostResult) error {
+	bw := bufio.NewWriter(w)
+	for _, h := range hosts {
+		var msg []byte
+		msg = appendPBString(msg, 1, h.IP)
+		msg = appendPBBool(msg, 2, h.Gateway)
+		msg = appendPBString(msg, 3, h.Name)
+		msg = appendPBString(msg, 4, h.Hostname)
+		msg = appendPBString(msg, 5, h.MAC)
+		msg = appendPBString(msg, 6, h.Vendor)
+		msg = appendPBVarint(msg, 8, uint64(h.TTL))
+		msg = appendPBString(msg, 9, h.OS)
+		msg = appendPBString(msg, 10, h.Method)
+		msg = appendPBDouble(msg, 11, rttMillis(h.RTT))
+		msg = appendPBString(msg, 12, h.AdminURL)
+		for _, p := range h.Ports {
+			var pm []byte
+			pm = appendPBVarint(pm, 1, uint64(p.Port))
+			pm = appendPBString(pm, 2, p.State)
+			pm = appendPBString(pm, 3, p.Proto)
+			pm = appendPBString(pm, 4, p.Service)
+			pm = appendPBString(pm, 5, p.Version)
+			if !*redact {
+				pm = appendPBString(pm, 6, p.Banner)
+			}
+			if c := p.Cert; c != nil {
+				var cm []byte
+				cm = appendPBString(cm, 1, displayName(c.Subject))
+				cm = appendPBString(cm, 2, displayName(c.Issuer))
+				for _, san := range c.SANs {
+					cm = appendPBString(cm, 3, displayName(san))
+				}
+				cm = appendPBVarint(cm, 4, uint64(c.NotAfter.Unix()))
+				pm = appendPBBytes(pm, 7, cm)
+			}
+			if w := p.HTTP; w != nil {
+				var wm []byte
+				wm = appendPBVarint(wm, 1, uint64(w.Status))
+				wm = appendPBString(wm, 2, w.Server)
+				if !*redact {
+					wm = appendPBString(wm, 3, w.Title)
+				}
+				wm = appendPBString(wm, 4, w.Favicon)
+				pm = appendPBBytes(pm, 8, wm)
+			}
+			msg = appendPBBytes(msg, 7, pm)
+		}
+		bw.Write(appendVarint(nil, uint64(len(msg))))
+		bw.Write(msg)
+	}
+	return bw.Flush()
+}
+
+// Protobuf wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendPBTag(b []byte, field, wire int) []byte {
+	return appendVarint(b, uint64(field)<<3|uint64(wire))
+}
+
+// appendPBString appends a string field, omitting it when empty as proto3 does.
+func appendPBString(b []byte, field int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = appendPBTag(b, field, wireBytes)
+	b = appendVarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// appendPBVarint appends an integer field, omitting it when zero as proto3 does.
+func appendPBVarint(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = appendPBTag(b, field, wireVarint)
+	return appendVarint(b, v)
+}
+
+// appendPBDouble appends a double field, omitting it when zero as proto3 does.
+func appendPBDouble(b []byte, field int, v float64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = appendPBTag(b, field, wireFixed64)
+	return binary.LittleEndian.AppendUint64(b, math.Float64bits(v))
+}
+
+// appendPBBytes appends an embedded message or bytes field.
+func appendPBBytes(b []byte, field int, v []byte) []byte {
+	b = appendPBTag(b, field, wireBytes)
+	b = appendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// appendPBBool appends a bool field, omitting it when false as proto3 does.
+func appendPBBool(b []byte, field int, v bool) []byte {
+	if !v {
+		return b
+	}
+	b = appendPBTag(b, field, wireVarint)
+	return append(b, 1)
+}
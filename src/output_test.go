@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"log"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// syntheticScan fills the result set with a fixed scan: two hosts, one
+// with a MAC, a reply TTL and open and closed ports (with a banner, a
+// certificate and a web fingerprint), one given by name.
+func syntheticScan(t *testing.T) {
+	t.Helper()
+	resetScan(t)
+	record("198.51.100.7", "icmp")
+	record("198.51.100.20", "tcp")
+	recordMAC("198.51.100.7", net.HardwareAddr{0xb8, 0x27, 0xeb, 0x01, 0x02, 0x03})
+	recordTTL("198.51.100.7", 63)
+	recordRTT("198.51.100.7", 1234567*time.Nanosecond)
+	targetNames[ipToInt("198.51.100.20")] = []string{"printer.lan"}
+	portResults.m["198.51.100.7"] = []portResult{
+		{Port: 443, Proto: "tcp", State: portOpen,
+			Cert: &certInfo{
+				Subject:  "CN=pi.lan",
+				Issuer:   "CN=Home CA",
+				SANs:     []string{"pi.lan", "198.51.100.7"},
+				NotAfter: time.Date(2099, 1, 1, 0, 0, 0, 0, time.UTC),
+			},
+			HTTP: &httpInfo{Status: 200, Server: "lighttpd/1.4", Title: "Pi-hole Admin", Favicon: "-1234567", Scheme: "https"},
+		},
+		{Port: 22, Proto: "tcp", State: portOpen, Service: "ssh", Version: "OpenSSH_9.6"},
+		{Port: 23, Proto: "tcp", State: portClosed},
+		{Port: 25, Proto: "tcp", State: portFiltered},
+	}
+}
+
+func TestPrintText(t *testing.T) {
+	syntheticScan(t)
+	buf := captureLog(t)
+	printText(log.Default(), hostResults())
+
+	got := buf.String()
+	for _, want := range []string{
+		"Unique IPs: 2\n",
+		"198.51.100.7 b8:27:eb:01:02:03 [Raspberry Pi] (ttl 63: Linux/Unix/macOS, 1 hop) (via icmp)\n",
+		"    22/tcp open ssh OpenSSH_9.6\n",
+		"    443/tcp open https\n",
+		"    (1 closed, 1 filtered)\n",
+		"198.51.100.20 (printer.lan) (via tcp)\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("text output is missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Index(got, "198.51.100.7") > strings.Index(got, "198.51.100.20") {
+		t.Errorf("hosts are out of order:\n%s", got)
+	}
+}
+
+func TestPrintTextRedacted(t *testing.T) {
+	syntheticScan(t)
+	setFlag(t, redact, true)
+	buf := captureLog(t)
+	printText(log.Default(), hostResults())
+	if got := buf.String(); strings.Contains(got, "198.51.100.") || strings.Contains(got, "printer.lan") {
+		t.Errorf("redacted output leaks addresses or names:\n%s", got)
+	}
+}
+
+// A gateway's web interface found by --http is shown as its admin URL.
+func TestGatewayAdminURL(t *testing.T) {
+	ports := []portResult{
+		{Port: 22, Proto: "tcp", State: portOpen, Service: "ssh"},
+		{Port: 8443, Proto: "tcp", State: portOpen, HTTP: &httpInfo{Status: 200, Scheme: "https"}},
+		{Port: 8080, Proto: "tcp", State: portOpen, HTTP: &httpInfo{Status: 200, Scheme: "http"}},
+	}
+	if got := adminURL("192.168.1.1", ports); got != "https://192.168.1.1:8443" {
+		t.Errorf("adminURL = %q", got)
+	}
+	if got := adminURL("192.168.1.1", ports[:1]); got != "" {
+		t.Errorf("adminURL without a web port = %q", got)
+	}
+
+	buf := captureLog(t)
+	printText(log.Default(), []hostResult{
+		{IP: "192.168.1.1", Gateway: true, AdminURL: "http://192.168.1.1:80"},
+		{IP: "10.0.0.1", Gateway: true},
+	})
+	for _, want := range []string{"192.168.1.1 (gateway, admin http://192.168.1.1:80)\n", "10.0.0.1 (gateway)\n"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("text output is missing %q:\n%s", want, buf)
+		}
+	}
+}
+
+func TestGuessOS(t *testing.T) {
+	for _, tt := range []struct {
+		ttl    int
+		family string
+		hops   int
+	}{
+		{1, "Windows 9x/embedded", 31},
+		{32, "Windows 9x/embedded", 0},
+		{33, "Linux/Unix/macOS", 31},
+		{64, "Linux/Unix/macOS", 0},
+		{63, "Linux/Unix/macOS", 1},
+		{65, "Windows", 63},
+		{128, "Windows", 0},
+		{120, "Windows", 8},
+		{129, "network device", 126},
+		{255, "network device", 0},
+		{256, "", 0},
+	} {
+		if family, hops := guessOS(tt.ttl); family != tt.family || hops != tt.hops {
+			t.Errorf("guessOS(%d) = %q, %d, want %q, %d", tt.ttl, family, hops, tt.family, tt.hops)
+		}
+	}
+	if got := describeTTL(300); got != "ttl 300" {
+		t.Errorf("describeTTL(300) = %q", got)
+	}
+}
+
+func TestMACVendor(t *testing.T) {
+	for _, tt := range []struct {
+		mac, vendor string
+	}{
+		{"b8:27:eb:01:02:03", "Raspberry Pi"},
+		{"B8-27-EB-FF-FF-FF", "Raspberry Pi"},
+		{"00:0c:29:aa:bb:cc", "VMware"},
+		{"00:00:01:00:00:00", ""},                     // not in the table
+		{"02:42:ac:11:00:02", "locally administered"}, // e.g. Docker
+		{"b6:27:eb:01:02:03", "locally administered"}, // randomized
+	} {
+		mac, err := net.ParseMAC(tt.mac)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := macVendor(mac); got != tt.vendor {
+			t.Errorf("macVendor(%s) = %q, want %q", tt.mac, got, tt.vendor)
+		}
+	}
+	if got := macVendor(net.HardwareAddr{0xb8, 0x27}); got != "" {
+		t.Errorf("macVendor of a short address = %q", got)
+	}
+}
+
+func TestParseOUI(t *testing.T) {
+	got := parseOUI("# comment\n\nb827eb  Raspberry Pi \n000C29 VMware\r\nBADLINE\n")
+	want := map[string]string{"B827EB": "Raspberry Pi", "000C29": "VMware"}
+	if len(got) != len(want) {
+		t.Errorf("parseOUI = %v, want %v", got, want)
+	}
+	for prefix, vendor := range want {
+		if got[prefix] != vendor {
+			t.Errorf("parseOUI[%s] = %q, want %q", prefix, got[prefix], vendor)
+		}
+	}
+}
+
+func TestWritePB(t *testing.T) {
+	syntheticScan(t)
+	var buf bytes.Buffer
+	if err := writePB(&buf, hostResults()); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := splitDelimited(t, buf.Bytes())
+	if len(msgs) != 2 {
+		t.Fatalf("got %d messages, want 2", len(msgs))
+	}
+	host := pbFields(t, msgs[0])
+	if got := string(host[1][0]); got != "198.51.100.7" {
+		t.Errorf("ip = %q", got)
+	}
+	if got := string(host[5][0]); got != "b8:27:eb:01:02:03" {
+		t.Errorf("mac = %q", got)
+	}
+	if got := len(host[7]); got != 4 {
+		t.Errorf("got %d ports, want 4", got)
+	}
+	if got := host[8][0][0]; got != 63 {
+		t.Errorf("ttl = %d", got)
+	}
+	port := pbFields(t, host[7][0]) // sorted: 22 first
+	if got := port[1][0][0]; got != 22 {
+		t.Errorf("first port = %d", got)
+	}
+	if got := string(port[4][0]); got != "ssh" {
+		t.Errorf("service = %q", got)
+	}
+	if got := string(host[10][0]); got != "icmp" {
+		t.Errorf("method = %q", got)
+	}
+	if got := math.Float64frombits(binary.LittleEndian.Uint64(host[11][0])); got != 1.235 {
+		t.Errorf("rtt_ms = %v, want 1.235", got)
+	}
+	if got := string(pbFields(t, msgs[1])[3][0]); got != "printer.lan" {
+		t.Errorf("name = %q", got)
+	}
+}
+
+// splitDelimited splits a stream of varint length-prefixed messages.
+func splitDelimited(t *testing.T, b []byte) [][]byte {
+	t.Helper()
+	var msgs [][]byte
+	for len(b) > 0 {
+		n, k := binary.Uvarint(b)
+		if k <= 0 || uint64(len(b)-k) < n {
+			t.Fatalf("bad length prefix")
+		}
+		msgs = append(msgs, b[k:k+int(n)])
+		b = b[k+int(n):]
+	}
+	return msgs
+}
+
+// pbFields decodes a protobuf message into field number -> values. Varint
+// fields hold their value as a single byte, which is enough for tests.
+func pbFields(t *testing.T, b []byte) map[int][][]byte {
+	t.Helper()
+	fields := make(map[int][][]byte)
+	for len(b) > 0 {
+		tag, k := binary.Uvarint(b)
+		if k <= 0 {
+			t.Fatalf("bad tag")
+		}
+		b = b[k:]
+		field := int(tag >> 3)
+		switch tag & 7 {
+		case wireVarint:
+			v, k := binary.Uvarint(b)
+			fields[field] = append(fields[field], []byte{byte(v)})
+			b = b[k:]
+		case wireFixed64:
+			fields[field] = append(fields[field], b[:8])
+			b = b[8:]
+		case wireBytes:
+			n, k := binary.Uvarint(b)
+			fields[field] = append(fields[field], b[k:k+int(n)])
+			b = b[k+int(n):]
+		default:
+			t.Fatalf("unexpected wire type %d", tag&7)
+		}
+	}
+	return fields
+}
+
+func TestRedactIPKeepsPrefix(t *testing.T) {
+	for _, pair := range [][2]string{
+		{"192.168.1.10", "192.168.1.20"},
+		{"fe80::1", "fe80::2"},
+	} {
+		a, b := redactIP(pair[0]), redactIP(pair[1])
+		if a == pair[0] || b == pair[1] {
+			t.Errorf("redactIP left %s or %s unchanged", pair[0], pair[1])
+		}
+		pa, pb := net.ParseIP(a), net.ParseIP(b)
+		n := len(pa.To16()) - 1
+		if pa.To4() != nil {
+			pa, pb, n = pa.To4(), pb.To4(), 3
+		}
+		if !bytes.Equal(pa[:n], pb[:n]) {
+			t.Errorf("redactIP(%s)=%s and redactIP(%s)=%s don't share a prefix", pair[0], a, pair[1], b)
+		}
+	}
+}
+
+func TestCSVTextDefusesFormulas(t *testing.T) {
+	for in, want := range map[string]string{
+		"printer.lan":       "printer.lan",
+		"=HYPERLINK(\"x\")": "'=HYPERLINK(\"x\")",
+		"-2+3":              "'-2+3",
+		"@SUM(A1)":          "'@SUM(A1)",
+		"":                  "",
+	} {
+		if got := csvText(in); got != want {
+			t.Errorf("csvText(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestFormatForPath(t *testing.T) {
+	for path, want := range map[string]string{
+		"results.json":      "ndjson",
+		"out/Results.CSV":   "csv",
+		"scan.gnmap":        "grep",
+		"hosts.txt":         "text",
+		"hosts.pb":          "pb",
+		"results":           "",
+		"results.json.part": "",
+	} {
+		got, err := formatForPath(path)
+		if got != want || (err != nil) != (want == "") {
+			t.Errorf("formatForPath(%q) = %q, %v, want %q", path, got, err, want)
+		}
+	}
+}
+
+// -o writes the same bytes the format would write to stdout, and no
+// temporary file is left behind next to it.
+func TestPrintResultsToFile(t *testing.T) {
+	syntheticScan(t)
+	captureLog(t)
+	path := filepath.Join(t.TempDir(), "results.csv")
+	setFlag(t, outFile, path)
+	setFlag(t, output, "csv")
+
+	printResults()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	if err := writeCSV(&want, hostResults()); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want.Bytes()) {
+		t.Errorf("-o wrote\n%s\nwant\n%s", got, want.Bytes())
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("%d files next to the results, want just the results", len(entries))
+	}
+}
+
+func TestGrepPortText(t *testing.T) {
+	for in, want := range map[string]string{
+		"OpenSSH_9.6":        "OpenSSH_9.6",
+		"nginx/1.25, Ubuntu": "nginx|1.25| Ubuntu",
+		"a\tb\nc":            "a b c",
+	} {
+		if got := grepPortText(in); got != want {
+			t.Errorf("grepPortText(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// Hosts are streamed as "host" events while the scan runs, with what
+// discovery recorded before adding them.
+func TestStreamHost(t *testing.T) {
+	resetScan(t)
+	captureLog(t)
+	setFlag(t, output, "ndjson")
+	var buf bytes.Buffer
+	setFlag(t, &streamOut.w, io.Writer(&buf))
+	c := useFakeClock(t)
+
+	recordTTL("198.51.100.7", 128)
+	recordRTT("198.51.100.7", 2500*time.Microsecond)
+	add("198.51.100.7", "icmp")
+	add("198.51.100.7", "tcp") // already found: no second event
+
+	want := `{"event":"host","time":"` + c.Now().Format(time.RFC3339Nano) + `","ip":"198.51.100.7","method":"icmp","ttl":128,"os_guess":"Windows","rtt_ms":2.5}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("streamed %s, want %s", got, want)
+	}
+}
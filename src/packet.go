@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// packetPool holds reusable buffers for building and receiving ICMP packets.
+var packetPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, 1500)
+		return &b
+	},
+}
+
+func getPacket() *[]byte { return packetPool.Get().(*[]byte) }
+
+func putPacket(b *[]byte) { packetPool.Put(b) }
+
+// echoPayload starts the data carried in every echo request. The send
+// time follows it, so the round-trip time can be read off the reply.
+var echoPayload = []byte("T")
+
+// marshalEcho writes an ICMPv4 echo request into b and returns the packet.
+// sent is the send time in Unix nanoseconds. It does the same job as
+// icmp.Message.Marshal but without allocating.
+func marshalEcho(b []byte, id, seq int, sent int64) []byte {
+	b = b[:8+len(echoPayload)+8]
+	b[0] = 8 // echo request
+	b[1] = 0
+	b[2], b[3] = 0, 0
+	binary.BigEndian.PutUint16(b[4:], uint16(id))
+	binary.BigEndian.PutUint16(b[6:], uint16(seq))
+	copy(b[8:], echoPayload)
+	binary.BigEndian.PutUint64(b[8+len(echoPayload):], uint64(sent))
+	binary.BigEndian.PutUint16(b[2:], checksum(b))
+	return b
+}
+
+// echoSent returns the send time carried back in an echo reply, in Unix
+// nanoseconds, if the reply holds one of our payloads.
+func echoSent(b []byte) (int64, bool) {
+	n := 8 + len(echoPayload)
+	if len(b) < n+8 || string(b[8:n]) != string(echoPayload) {
+		return 0, false
+	}
+	return int64(binary.BigEndian.Uint64(b[n:])), true
+}
+
+// checksum computes the Internet checksum (RFC 1071) of b.
+func checksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+// isEchoReply reports whether the ICMP message in b is an echo reply,
+// without parsing it into an icmp.Message.
+func isEchoReply(b []byte) bool {
+	return len(b) >= 8 && b[0] == 0 && b[1] == 0
+}
+
+// marshalTimestamp writes an ICMPv4 timestamp request (RFC 792) into b
+// and returns the packet. originate is milliseconds since midnight UTC.
+// Hosts that filter echo requests often still answer these.
+func marshalTimestamp(b []byte, id, seq int, originate uint32) []byte {
+	b = b[:20]
+	clear(b)
+	b[0] = 13 // timestamp request
+	binary.BigEndian.PutUint16(b[4:], uint16(id))
+	binary.BigEndian.PutUint16(b[6:], uint16(seq))
+	binary.BigEndian.PutUint32(b[8:], originate)
+	binary.BigEndian.PutUint16(b[2:], checksum(b))
+	return b
+}
+
+// msSinceMidnight returns t as milliseconds since midnight UTC, the unit
+// of ICMP timestamps.
+func msSinceMidnight(t time.Time) uint32 {
+	t = t.UTC()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return uint32(t.Sub(midnight).Milliseconds())
+}
+
+// timestampRTT returns the round-trip time of a timestamp reply received
+// at now, from the originate timestamp the host copied back. ICMP
+// timestamps only have millisecond resolution.
+func timestampRTT(b []byte, now time.Time) time.Duration {
+	const day = 24 * 60 * 60 * 1000
+	originate := binary.BigEndian.Uint32(b[8:])
+	ms := (int64(msSinceMidnight(now)) - int64(originate) + day) % day
+	return time.Duration(ms) * time.Millisecond
+}
+
+// isTimestampReply reports whether the ICMP message in b is a timestamp
+// reply.
+func isTimestampReply(b []byte) bool {
+	return len(b) >= 20 && b[0] == 14 && b[1] == 0
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"testing"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+func TestMarshalEchoMatchesICMP(t *testing.T) {
+	for _, tt := range []struct {
+		id, seq int
+		sent    int64
+	}{{0, 0, 0}, {1, 1, 1}, {0xbeef, 0x1234, 1700000000123456789}, {0xffff, 0xffff, -1}} {
+		data := binary.BigEndian.AppendUint64(append([]byte(nil), echoPayload...), uint64(tt.sent))
+		want, err := (&icmp.Message{
+			Type: ipv4.ICMPTypeEcho,
+			Body: &icmp.Echo{ID: tt.id, Seq: tt.seq, Data: data},
+		}).Marshal(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := make([]byte, 1500)
+		got := marshalEcho(b, tt.id, tt.seq, tt.sent)
+		if !bytes.Equal(got, want) {
+			t.Errorf("marshalEcho(%#x, %#x) = %x, want %x", tt.id, tt.seq, got, want)
+		}
+		if sent, ok := echoSent(got); !ok || sent != tt.sent {
+			t.Errorf("echoSent = %d, %v, want %d", sent, ok, tt.sent)
+		}
+	}
+	if _, ok := echoSent(marshalEcho(make([]byte, 1500), 1, 1, 0)[:12]); ok {
+		t.Error("echoSent read a send time from a truncated reply")
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	// A packet with its checksum filled in sums to zero
+	pkt := marshalEcho(make([]byte, 1500), 0x1337, 42, 0)
+	if c := checksum(pkt); c != 0 {
+		t.Errorf("checksum over a checksummed packet = %#x, want 0", c)
+	}
+	// Odd lengths pad with a zero byte
+	if got, want := checksum([]byte{0x01}), checksum([]byte{0x01, 0x00}); got != want {
+		t.Errorf("odd-length checksum = %#x, want %#x", got, want)
+	}
+}
+
+func TestIsEchoReply(t *testing.T) {
+	reply, _ := (&icmp.Message{Type: ipv4.ICMPTypeEchoReply, Body: &icmp.Echo{ID: 1, Seq: 1}}).Marshal(nil)
+	request := marshalEcho(make([]byte, 1500), 1, 1, 0)
+	unreachable, _ := (&icmp.Message{Type: ipv4.ICMPTypeDestinationUnreachable, Code: 1, Body: &icmp.DstUnreach{}}).Marshal(nil)
+	for _, tt := range []struct {
+		name string
+		pkt  []byte
+		want bool
+	}{
+		{"echo reply", reply, true},
+		{"echo request", request, false},
+		{"unreachable", unreachable, false},
+		{"truncated", reply[:4], false},
+		{"empty", nil, false},
+	} {
+		if got := isEchoReply(tt.pkt); got != tt.want {
+			t.Errorf("isEchoReply(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMarshalTimestamp(t *testing.T) {
+	pkt := marshalTimestamp(make([]byte, 1500), 0xbeef, 7, 12345678)
+	if c := checksum(pkt); c != 0 {
+		t.Errorf("checksum over a timestamp request = %#x, want 0", c)
+	}
+	msg, err := icmp.ParseMessage(1, pkt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != ipv4.ICMPTypeTimestamp || len(pkt) != 20 {
+		t.Errorf("got %v of %d bytes, want a 20 byte timestamp request", msg.Type, len(pkt))
+	}
+	reply := append([]byte(nil), pkt...)
+	reply[0] = 14
+
+	// The RTT comes from the originate timestamp, across midnight too
+	sent := time.Date(2024, 1, 1, 23, 59, 59, 998e6, time.UTC)
+	ts := marshalTimestamp(make([]byte, 1500), 1, 1, msSinceMidnight(sent))
+	if rtt := timestampRTT(ts, sent.Add(5*time.Millisecond)); rtt != 5*time.Millisecond {
+		t.Errorf("timestampRTT across midnight = %v, want 5ms", rtt)
+	}
+	if isTimestampReply(pkt) || !isTimestampReply(reply) || isTimestampReply(reply[:8]) {
+		t.Error("isTimestampReply misclassifies requests, replies or truncated packets")
+	}
+}
+
+// TestHandleReply covers the reply dispatcher: only echo and timestamp
+// replies make a host live, each host is recorded once however often it
+// answers, and the first kind of reply is kept as its method.
+// A raw socket's batched reads keep the IP header, options and all.
+func TestIPv4Payload(t *testing.T) {
+	msg := []byte{0, 0, 0xff, 0xff, 0, 1, 0, 1}
+	options := []byte{1, 1, 1, 1}
+	for _, tt := range []struct {
+		name string
+		hlen int
+		tail []byte // what follows the fixed header
+		want []byte
+	}{
+		{"plain", ipv4.HeaderLen, msg, msg},
+		{"options", ipv4.HeaderLen + len(options), append(options, msg...), msg},
+		{"short header", ipv4.HeaderLen - 4, msg, nil},
+		{"header past the end", ipv4.HeaderLen + 16, msg, nil},
+	} {
+		hdr := make([]byte, ipv4.HeaderLen)
+		hdr[0] = 4<<4 | byte(tt.hlen/4)
+		b := make([]byte, 1500)
+		n := ipv4.HeaderLen + copy(b, tt.tail)
+		if got := ipv4Payload(hdr, b, n); !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: payload = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if got := ipv4Payload(make([]byte, ipv4.HeaderLen), nil, 3); got != nil {
+		t.Errorf("truncated header: payload = %v", got)
+	}
+}
+
+func TestHandleReply(t *testing.T) {
+	resetScan(t)
+	captureLog(t)
+	reply, _ := (&icmp.Message{Type: ipv4.ICMPTypeEchoReply, Body: &icmp.Echo{ID: 1, Seq: 1}}).Marshal(nil)
+	request := marshalEcho(make([]byte, 1500), 1, 1, 0)
+	tsReply := marshalTimestamp(make([]byte, 1500), 1, 1, 0)
+	tsReply[0] = 14
+
+	handleReply("10.0.0.1", request)
+	handleReply("10.0.0.2", reply)
+	handleReply("10.0.0.2", tsReply)
+	handleReply("10.0.0.3", tsReply)
+	if got := results(); !equalStrings(got, []string{"10.0.0.2", "10.0.0.3"}) {
+		t.Errorf("results = %v", got)
+	}
+	if foundBy("10.0.0.2") != "icmp" || foundBy("10.0.0.3") != "timestamp" {
+		t.Errorf("methods = %q, %q", foundBy("10.0.0.2"), foundBy("10.0.0.3"))
+	}
+}
+
+func TestResultsSorted(t *testing.T) {
+	resetScan(t)
+	for _, ip := range []string{"10.0.0.10", "10.0.0.9", "9.255.255.255", "10.0.0.100"} {
+		record(ip, "icmp")
+	}
+	want := []string{"9.255.255.255", "10.0.0.9", "10.0.0.10", "10.0.0.100"}
+	if got := results(); !equalStrings(got, want) {
+		t.Errorf("results = %v, want %v", got, want)
+	}
+}
+
+// The same --seed draws the same source ports and sequence numbers.
+func TestSeedRepeatsProbeValues(t *testing.T) {
+	old := probeRand.r
+	t.Cleanup(func() { probeRand.r = old })
+	draw := func() [3]uint32 {
+		probeRand.r = rand.New(rand.NewSource(42))
+		return [3]uint32{uint32(probeIntn(0x10000)), uint32(probeIntn(20000)), probeUint32()}
+	}
+	if a, b := draw(), draw(); a != b {
+		t.Errorf("seed 42 drew %v, then %v", a, b)
+	}
+}
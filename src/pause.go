@@ -0,0 +1,44 @@
+package main
+
+import (
+	"log"
+	"sync"
+)
+
+// gate lets a scan be paused and resumed. Probes wait at the gate before
+// sending, so targets not yet probed stay queued while paused.
+type gate struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	paused bool
+}
+
+var scanGate = newGate()
+
+func newGate() *gate {
+	g := &gate{}
+	g.cond = sync.NewCond(&g.mu)
+	return g
+}
+
+// wait blocks while the gate is paused.
+func (g *gate) wait() {
+	g.mu.Lock()
+	for g.paused {
+		g.cond.Wait()
+	}
+	g.mu.Unlock()
+}
+
+// toggle flips between paused and running.
+func (g *gate) toggle() {
+	g.mu.Lock()
+	g.paused = !g.paused
+	if g.paused {
+		log.Printf("Scan paused")
+	} else {
+		log.Printf("Scan resumed")
+	}
+	g.mu.Unlock()
+	g.cond.Broadcast()
+}
@@ -0,0 +1,22 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func init() { registerFeature("pause-signal") }
+
+// handlePauseSignals toggles the scan gate on every SIGUSR1.
+func handlePauseSignals() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1)
+	go func() {
+		for range ch {
+			scanGate.toggle()
+		}
+	}()
+}
@@ -0,0 +1,4 @@
+package main
+
+// handlePauseSignals is a no-op: Windows has no SIGUSR1.
+func handlePauseSignals() {}
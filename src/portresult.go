@@ -0,0 +1,109 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Port states reported by the port scanners.
+const (
+	portOpen     = "open"
+	portClosed   = "closed"
+	portFiltered = "filtered"
+)
+
+// portResult is the state of one port on a host.
+type portResult struct {
+	Port  int
+	Proto string // "tcp" or "udp"
+	State string
+
+	// Filled in by --banners for open TCP ports
+	Service string // service identified from the banner
+	Version string // server software and version, if advertised
+	Banner  string // first line the service sent
+
+	Cert *certInfo // leaf certificate, filled in by --tls
+	HTTP *httpInfo // web fingerprint, filled in by --http
+}
+
+// httpInfo fingerprints the web service on a port.
+type httpInfo struct {
+	Status  int    // status code for GET /
+	Server  string // Server header
+	Title   string // page <title>
+	Favicon string // Shodan-style favicon hash, if /favicon.ico exists
+	Scheme  string // "http" or "https", as the page was fetched
+}
+
+// certInfo is the part of a server certificate worth reporting.
+type certInfo struct {
+	Subject  string
+	Issuer   string
+	SANs     []string // DNS names and IP addresses
+	NotAfter time.Time
+}
+
+// certWarn is how close to expiry a certificate is flagged (--cert-warn).
+var certWarn = 30 * 24 * time.Hour
+
+// portResults holds the port states found per host IP. In low-memory mode
+// closed and filtered ports are only counted in dropped.
+var portResults = struct {
+	sync.Mutex
+	m       map[string][]portResult
+	dropped int
+}{m: make(map[string][]portResult)}
+
+// storePort records the state of one port on ip.
+func storePort(ip string, r portResult) {
+	portResults.Lock()
+	defer portResults.Unlock()
+	if *lowMemory && (r.State == portClosed || r.State == portFiltered) {
+		portResults.dropped++
+		return
+	}
+	portResults.m[ip] = append(portResults.m[ip], r)
+}
+
+// droppedPorts returns how many port results low-memory mode didn't keep.
+func droppedPorts() int {
+	portResults.Lock()
+	defer portResults.Unlock()
+	return portResults.dropped
+}
+
+// hostPorts returns the port states found for ip, sorted by port.
+func hostPorts(ip string) []portResult {
+	portResults.Lock()
+	defer portResults.Unlock()
+	ports := append([]portResult(nil), portResults.m[ip]...)
+	sort.Slice(ports, func(i, j int) bool { return ports[i].Port < ports[j].Port })
+	return ports
+}
+
+// certExpiry describes when a certificate expires relative to now, and
+// whether that is within warn.
+func certExpiry(notAfter time.Time, warn time.Duration) (string, bool) {
+	left := time.Until(notAfter)
+	days := int(left.Hours() / 24)
+	switch {
+	case left < 0:
+		return "EXPIRED " + strconv.Itoa(-days) + " days ago", true
+	case left < warn:
+		return "expires in " + strconv.Itoa(days) + " days", true
+	}
+	return "expires " + notAfter.Format("2006-01-02"), false
+}
+
+// sanList renders SANs for display, pseudonymized with --redact.
+func sanList(sans []string) string {
+	out := make([]string, len(sans))
+	for i, s := range sans {
+		out[i] = displayName(s)
+	}
+	return strings.Join(out, ",")
+}
@@ -0,0 +1,219 @@
+//go:build !noports
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+func init() { registerFeature("ports", "tcp-connect") }
+
+// portScan holds the options for "scli ports".
+type portScan struct {
+	ports       []int
+	concurrency int
+	timeout     time.Duration
+	syn         bool     // half-open raw SYN scan instead of connects
+	udp         bool     // scan UDP ports instead of TCP
+	banners     bool     // read service banners from open TCP ports
+	certs       bool     // report certificates of open TLS ports
+	http        bool     // fingerprint open web ports
+	targets     []string // explicit targets: scanned without discovery
+}
+
+// parsePortArgs parses the flags and targets that follow "scli ports".
+func parsePortArgs(args []string) (*portScan, error) {
+	fs := flag.NewFlagSet("ports", flag.ContinueOnError)
+	list := fs.String("ports", "22,80,443", "ports to scan: numbers, ranges and service names, e.g. 22,8000-8100,https (default for --udp: "+defaultUDPPorts+")")
+	top := fs.Int("top-ports", 0, "scan the N most commonly open ports")
+	concurrency := fs.Int("port-concurrency", 100, "parallel port probes")
+	timeout := fs.Duration("port-timeout", time.Second, "timeout for each port probe")
+	syn := fs.Bool("syn", false, "half-open SYN scan over a raw socket (root, Linux)")
+	udp := fs.Bool("udp", false, "scan UDP ports with protocol-aware payloads")
+	certs := fs.Bool("tls", false, "handshake with open TLS ports and report their certificates")
+	fs.DurationVar(&certWarn, "cert-warn", certWarn, "flag certificates that expire within this long")
+	web := fs.Bool("http", false, "fetch / from open web ports and record status, Server header, title and favicon hash")
+	banners := fs.Bool("banners", false, "read a banner from each open TCP port to identify the service and version")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if *syn && *udp {
+		return nil, errors.New("--syn and --udp can't be used together")
+	}
+	if *syn && termuxMode {
+		log.Printf("SYN scanning needs raw sockets, using TCP connect scans instead")
+		*syn = false
+	}
+	if (*banners || *certs || *web) && *udp {
+		return nil, errors.New("--banners, --tls and --http only work for TCP scans")
+	}
+	if *lowMemory && !flagSet(fs, "port-concurrency") {
+		*concurrency = lowMemPortConcurrency
+	}
+	proto := "tcp"
+	if *udp {
+		proto = "udp"
+	}
+	spec := *list
+	switch {
+	case *top > 0 && !flagSet(fs, "ports"):
+		spec = ""
+	case *udp && !flagSet(fs, "ports"):
+		spec = defaultUDPPorts
+	}
+
+	ps := &portScan{concurrency: *concurrency, timeout: *timeout, syn: *syn, udp: *udp, banners: *banners, certs: *certs, http: *web, targets: fs.Args()}
+	ports, err := parsePortSpec(spec, proto)
+	if err != nil {
+		return nil, err
+	}
+	if *top > 0 {
+		topList, err := topPortList(*top, proto)
+		if err != nil {
+			return nil, err
+		}
+		ports, _ = parsePortSpec(joinPorts(append(ports, topList...)), proto)
+	}
+	ps.ports = ports
+	if len(ps.ports) == 0 {
+		return nil, errors.New("no ports to scan")
+	}
+	return ps, nil
+}
+
+// scan connects to every port on every host. Hosts that answer on any
+// port (open or closed) are recorded as live, so explicit targets that
+// skipped discovery still show up in the results.
+func (ps *portScan) scan(hosts []string) {
+	if ps.http {
+		defer ps.fingerprintHTTP()
+	}
+	if ps.certs {
+		defer ps.inspectCerts()
+	}
+	if ps.banners {
+		defer ps.grabBanners()
+	}
+	if ps.syn {
+		if err := ps.scanSYN(hosts); err != nil {
+			log.Fatalf("Error running SYN scan: %s", err)
+		}
+		return
+	}
+
+	probe, proto := ps.probe, "tcp"
+	if ps.udp {
+		probe, proto = ps.probeUDP, "udp"
+	}
+
+	type job struct {
+		ip   string
+		port int
+	}
+	jobs := make(chan job)
+	var wg sync.WaitGroup
+	for i := 0; i < max(ps.concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				state := probe(j.ip, j.port)
+				storePort(j.ip, portResult{Port: j.port, Proto: proto, State: state})
+				if state == portOpen || state == portClosed {
+					add(j.ip, proto)
+				}
+			}
+		}()
+	}
+
+	skipped := 0
+	for _, ip := range hosts {
+		for _, port := range ps.ports {
+			scanGate.wait()
+			if pastDeadline() {
+				skipped++
+				continue
+			}
+			jobs <- job{ip, port}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if skipped > 0 {
+		log.Printf("Deadline reached: %d port probes skipped", skipped)
+	}
+}
+
+// probe attempts a TCP connect to ip:port and classifies the outcome.
+func (ps *portScan) probe(ip string, port int) string {
+	addr := net.JoinHostPort(ip, strconv.Itoa(port))
+	for attempt := 0; ; attempt++ {
+		sendLimiter.acquire()
+		conn, err := net.DialTimeout("tcp4", addr, ps.timeout)
+		sendLimiter.release()
+		if err == nil {
+			conn.Close()
+			return portOpen
+		}
+		if isConnRefused(err) {
+			return portClosed
+		}
+		if isResourceError(err) && attempt < 5 {
+			sendLimiter.reduce(err)
+			backoff(attempt)
+			continue
+		}
+		return portFiltered
+	}
+}
+
+// eachOpenTCP calls fn for every open TCP port found, ps.concurrency at a
+// time. A non-nil func returned by fn is applied to the port's result.
+func (ps *portScan) eachOpenTCP(fn func(ip string, port int) func(*portResult)) {
+	type job struct {
+		ip   string
+		i    int
+		port int
+	}
+	var jobs []job
+	portResults.Lock()
+	for ip, ports := range portResults.m {
+		for i, p := range ports {
+			if p.Proto == "tcp" && p.State == portOpen {
+				jobs = append(jobs, job{ip, i, p.Port})
+			}
+		}
+	}
+	portResults.Unlock()
+
+	work := make(chan job)
+	var wg sync.WaitGroup
+	for i := 0; i < max(ps.concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range work {
+				if update := fn(j.ip, j.port); update != nil {
+					portResults.Lock()
+					update(&portResults.m[j.ip][j.i])
+					portResults.Unlock()
+				}
+			}
+		}()
+	}
+	for _, j := range jobs {
+		if pastDeadline() {
+			break
+		}
+		work <- j
+	}
+	close(work)
+	wg.Wait()
+}
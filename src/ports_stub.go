@@ -0,0 +1,17 @@
+//go:build noports
+
+package main
+
+import "errors"
+
+// portScan is empty in builds without port scanning.
+type portScan struct {
+	targets []string
+}
+
+// parsePortArgs reports that "scli ports" was compiled out.
+func parsePortArgs(args []string) (*portScan, error) {
+	return nil, errors.New("port scanning is not available in this build (built with -tags noports)")
+}
+
+func (ps *portScan) scan(hosts []string) {}
@@ -0,0 +1,199 @@
+//go:build !noports
+
+package main
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestParsePortSpec(t *testing.T) {
+	tests := []struct {
+		spec, proto string
+		want        []int
+	}{
+		{"22,80,443", "tcp", []int{22, 80, 443}},
+		{"443, 22 ,22", "tcp", []int{22, 443}},
+		{"8000-8003", "tcp", []int{8000, 8001, 8002, 8003}},
+		{"ssh,http,HTTPS", "tcp", []int{22, 80, 443}},
+		{"dns,ntp", "udp", []int{53, 123}},
+		{"ntp", "tcp", []int{123}}, // falls back to the UDP entry
+		{"", "tcp", []int{}},
+	}
+	for _, tt := range tests {
+		got, err := parsePortSpec(tt.spec, tt.proto)
+		if err != nil {
+			t.Errorf("parsePortSpec(%q): %s", tt.spec, err)
+			continue
+		}
+		if joinPorts(got) != joinPorts(tt.want) {
+			t.Errorf("parsePortSpec(%q) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+	for _, bad := range []string{"0", "65536", "10-5", "1-70000", "nosuchservice", "22,x"} {
+		if got, err := parsePortSpec(bad, "tcp"); err == nil {
+			t.Errorf("parsePortSpec(%q) = %v, want error", bad, got)
+		}
+	}
+}
+
+func TestParsePortArgs(t *testing.T) {
+	ps, err := parsePortArgs([]string{"--top-ports", "3", "--ports", "22", "10.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := joinPorts(ps.ports); got != "22,23,80,443" {
+		t.Errorf("ports = %s", got)
+	}
+	if !equalStrings(ps.targets, []string{"10.0.0.1"}) {
+		t.Errorf("targets = %v", ps.targets)
+	}
+
+	ps, err = parsePortArgs([]string{"--udp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := joinPorts(ps.ports); got != defaultUDPPorts {
+		t.Errorf("default UDP ports = %s", got)
+	}
+
+	if _, err := parsePortArgs([]string{"--syn", "--udp"}); err == nil {
+		t.Error("--syn with --udp was accepted")
+	}
+}
+
+// TestPortScanLoopback runs a real TCP connect scan against a listener on
+// loopback: one open port, one closed.
+func TestPortScanLoopback(t *testing.T) {
+	resetScan(t)
+	captureLog(t)
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c.Write([]byte("SSH-2.0-TestServer_1.0\r\n"))
+			c.Close()
+		}
+	}()
+	open := ln.Addr().(*net.TCPAddr).Port
+
+	// Grab a port that is certainly closed by listening and closing
+	tmp, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := tmp.Addr().(*net.TCPAddr).Port
+	tmp.Close()
+
+	ps := &portScan{ports: []int{open, closed}, concurrency: 2, timeout: time.Second, banners: true}
+	ps.scan([]string{"127.0.0.1"})
+
+	if got := results(); !equalStrings(got, []string{"127.0.0.1"}) {
+		t.Fatalf("results = %v", got)
+	}
+	states := make(map[int]portResult)
+	for _, p := range hostPorts("127.0.0.1") {
+		states[p.Port] = p
+	}
+	if p := states[open]; p.State != portOpen || p.Service != "ssh" || p.Version != "TestServer_1.0" {
+		t.Errorf("port %d = %+v, want open ssh TestServer_1.0", open, p)
+	}
+	if p := states[closed]; p.State != portClosed {
+		t.Errorf("port %s = %s, want closed", strconv.Itoa(closed), p.State)
+	}
+}
+
+func FuzzParsePortSpec(f *testing.F) {
+	for _, s := range []string{"22,80,443", "8000-8100", "ssh,http", "1-65535", "0", "-", "5-", ",,"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, spec string) {
+		ports, err := parsePortSpec(spec, "tcp")
+		if err != nil {
+			return
+		}
+		for i, p := range ports {
+			if p < 1 || p > 65535 || (i > 0 && p <= ports[i-1]) {
+				t.Fatalf("parsePortSpec(%q) = bad port list %v", spec, ports)
+			}
+		}
+	})
+}
+
+func FuzzIdentifyBanner(f *testing.F) {
+	for _, s := range []string{
+		"SSH-2.0-OpenSSH_9.6\r\n", "HTTP/1.1 200 OK\r\nServer: nginx\r\n\r\n", "220 (vsFTPd 3.0.5)\r\n",
+		"220", "+OK", "* OK", "SSH-", "\xff\x00", "SSH-2.0-evil\x1b[2J\xff\r\n",
+	} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, banner string) {
+		service, version := identifyBanner(banner)
+		for _, s := range []string{service, version} {
+			if s != cleanText(s, httpTextMax) {
+				t.Fatalf("identifyBanner(%q) = uncleaned %q", banner, s)
+			}
+		}
+		for _, r := range cleanBanner(banner) {
+			if r < 0x20 || r > 0x7e {
+				t.Fatalf("cleanBanner(%q) kept %q", banner, r)
+			}
+		}
+	})
+}
+
+// The hashes match Python's mmh3.hash(codecs.encode(icon, "base64")),
+// which is how Shodan computes http.favicon.hash.
+func TestFaviconHash(t *testing.T) {
+	all := make([]byte, 256) // wraps the base64 onto several lines
+	for i := range all {
+		all[i] = byte(i)
+	}
+	for _, tt := range []struct {
+		name string
+		icon []byte
+		want int32
+	}{
+		{"short", []byte{0, 1, 2}, 304933308},
+		{"multi-line", all, -757223386},
+	} {
+		if got := faviconHash(tt.icon); got != tt.want {
+			t.Errorf("%s: faviconHash = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+	for data, want := range map[string]uint32{
+		"":      0,
+		"hello": 0x248bfa47,
+		"The quick brown fox jumps over the lazy dog": 0x2e4ff723,
+	} {
+		if got := murmur3([]byte(data)); got != want {
+			t.Errorf("murmur3(%q) = %#x, want %#x", data, got, want)
+		}
+	}
+}
+
+func TestCleanText(t *testing.T) {
+	for _, tt := range []struct{ in, want string }{
+		{"  Router\n  Admin ", "Router Admin"},
+		{"a\tb\x1b[31mc\x7f", "a b [31mc"},
+		{"bad \xff\xfe utf8", "bad \uFFFD utf8"},
+		{strings.Repeat("é", 60), strings.Repeat("é", 50)}, // 2-byte runes, cut at 100 bytes
+		{strings.Repeat("x", 99) + "é", strings.Repeat("x", 99)},
+	} {
+		got := cleanText(tt.in, httpTextMax)
+		if got != tt.want || !utf8.ValidString(got) || len(got) > httpTextMax {
+			t.Errorf("cleanText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+// procAddr renders ip the way /proc/net/route does: a host-order integer
+// in hex.
+func procAddr(ip string) string {
+	return fmt.Sprintf("%08X", binary.NativeEndian.Uint32(net.ParseIP(ip).To4()))
+}
+
+func TestParseRoutes(t *testing.T) {
+	const header = "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n"
+	for _, tt := range []struct {
+		name  string
+		table string
+		want  []string
+	}{
+		{"default route", header +
+			"eth0\t00000000\t" + procAddr("192.168.1.1") + "\t0003\t0\t0\t100\t00000000\t0\t0\t0\n" +
+			"eth0\t" + procAddr("192.168.1.0") + "\t00000000\t0001\t0\t0\t100\t00FFFFFF\t0\t0\t0\n",
+			[]string{"192.168.1.1"}},
+		{"two default routes", header +
+			"eth0\t00000000\t" + procAddr("10.0.0.1") + "\t0003\t0\t0\t100\t00000000\t0\t0\t0\n" +
+			"wlan0\t00000000\t" + procAddr("172.16.0.254") + "\t0003\t0\t0\t600\t00000000\t0\t0\t0\n",
+			[]string{"10.0.0.1", "172.16.0.254"}},
+		{"on-link default route", header + "tun0\t00000000\t00000000\t0001\t0\t0\t0\t00000000\t0\t0\t0\n", nil},
+		{"malformed lines", header + "eth0\t00000000\n" + "eth0\t00000000\tnot-hex\t0003\n", nil},
+		{"empty", "", nil},
+	} {
+		if got := parseRoutes(strings.NewReader(tt.table)); !equalStrings(got, tt.want) {
+			t.Errorf("%s: gateways = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseARPTable(t *testing.T) {
+	table := "IP address       HW type     Flags       HW address            Mask     Device\n" +
+		"192.168.1.1      0x1         0x2         b8:27:eb:01:02:03     *        eth0\n" +
+		"192.168.1.7      0x1         0x0         00:00:00:00:00:00     *        eth0\n" +
+		"192.168.1.9      0x1         0x2         not-a-mac             *        eth0\n" +
+		"192.168.1.20     0x1         0x6         00:0c:29:aa:bb:cc     *        eth0\n" +
+		"short line\n"
+	got := parseARPTable(strings.NewReader(table))
+	want := map[string]string{"192.168.1.1": "b8:27:eb:01:02:03", "192.168.1.20": "00:0c:29:aa:bb:cc"}
+	if len(got) != len(want) {
+		t.Errorf("table = %v, want %v", got, want)
+	}
+	for ip, mac := range want {
+		if got[ip].String() != mac {
+			t.Errorf("%s = %v, want %s", ip, got[ip], mac)
+		}
+	}
+}
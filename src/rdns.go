@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lookupHostnames resolves the PTR record of each IP using up to
+// concurrency parallel queries, each bounded by timeout and all by the
+// scan --deadline. IPs without a PTR record are left out of the result.
+func lookupHostnames(ips []string, concurrency int, timeout time.Duration) map[string]string {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	ctx := context.Background()
+	if !scanDeadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, scanDeadline.Sub(scanClock.Now()))
+		defer cancel()
+	}
+	var mu sync.Mutex
+	names := make(map[string]string)
+
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ip := range jobs {
+				lookupCtx, cancel := context.WithTimeout(ctx, timeout)
+				ptrs, err := net.DefaultResolver.LookupAddr(lookupCtx, ip)
+				cancel()
+				if err != nil || len(ptrs) == 0 {
+					continue
+				}
+				mu.Lock()
+				names[ip] = strings.TrimSuffix(ptrs[0], ".")
+				mu.Unlock()
+			}
+		}()
+	}
+	skipped := 0
+	for _, ip := range ips {
+		if ctx.Err() != nil {
+			skipped++
+			continue
+		}
+		jobs <- ip
+	}
+	close(jobs)
+	wg.Wait()
+	if skipped > 0 {
+		log.Printf("Deadline reached: %d reverse DNS lookups skipped", skipped)
+	}
+	return names
+}
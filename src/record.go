@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// recorder appends every raw reply to a --record session file.
+//
+// The file starts with sessionMagic and a version byte. Each record after
+// it is: 8-byte unix-nano timestamp, 1-byte reply TTL, 8-byte RTT in
+// nanoseconds, 1-byte peer length, peer address, 2-byte packet length,
+// packet bytes (all big-endian). A TTL or RTT of 0 wasn't measured.
+// Version 2 records lack the TTL and RTT, and version 1 files, written
+// before the header existed, are bare version 2 records.
+type recorder struct {
+	mu sync.Mutex
+	f  *os.File
+	w  *bufio.Writer
+}
+
+// sessionMagic starts every session file from version 2 on. A version 1
+// record can't begin with it until its timestamp passes the year 2200.
+const sessionMagic = "SCLIREC"
+
+// sessionVersion is the session file format this binary writes.
+const sessionVersion = 3
+
+// recordedReply is one reply as stored in a session file.
+type recordedReply struct {
+	at   int64 // unix nanoseconds
+	peer string
+	ttl  int
+	rtt  time.Duration
+	pkt  []byte
+}
+
+// appendRecord appends rec to b in the current record format.
+func appendRecord(b []byte, rec recordedReply) []byte {
+	b = binary.BigEndian.AppendUint64(b, uint64(rec.at))
+	b = append(b, byte(rec.ttl))
+	b = binary.BigEndian.AppendUint64(b, uint64(rec.rtt))
+	b = append(b, byte(len(rec.peer)))
+	b = append(b, rec.peer...)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(rec.pkt)))
+	return append(b, rec.pkt...)
+}
+
+// sessionRecorder is nil unless --record was given.
+var sessionRecorder *recorder
+
+// checkRecord checks what --record can capture for this scan. Only ICMP
+// echo and timestamp replies are recorded, since replay feeds them back
+// through the ICMP reply handler, so it warns about the other probes and
+// fails when the scan sends no ICMP probes at all.
+func checkRecord(methods map[string]bool, ports *portScan) error {
+	if *recordPath == "" {
+		return nil
+	}
+	directPorts := ports != nil && len(ports.targets) > 0
+	if *ipv6Scan || directPorts || !(methods["icmp"] || methods["timestamp"]) {
+		return errors.New("--record only captures ICMP echo and timestamp replies, and this scan sends none")
+	}
+	var missed []string
+	for _, m := range discoveryOrder {
+		if methods[m] && m != "icmp" && m != "timestamp" {
+			missed = append(missed, m)
+		}
+	}
+	if *mdnsScan {
+		missed = append(missed, "mdns")
+	}
+	if ports != nil {
+		missed = append(missed, "ports")
+	}
+	if len(missed) > 0 {
+		scanWarning("--record only captures ICMP replies, not %s: a replay won't show what those found", strings.Join(missed, ", "))
+	}
+	return nil
+}
+
+func openRecorder(path string) (*recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &recorder{f: f, w: bufio.NewWriter(f)}
+	r.w.WriteString(sessionMagic)
+	r.w.WriteByte(sessionVersion)
+	return r, nil
+}
+
+// write stores one reply from peer, with the TTL and RTT measured for
+// it, so a replay reports them too.
+func (r *recorder) write(peer string, ttl int, rtt time.Duration, pkt []byte) {
+	rec := recordedReply{at: scanClock.Now().UnixNano(), peer: peer, ttl: ttl, rtt: rtt, pkt: pkt}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.w.Write(appendRecord(nil, rec))
+}
+
+func (r *recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.w.Flush(); err != nil {
+		r.f.Close()
+		return err
+	}
+	return r.f.Close()
+}
+
+// replay feeds every reply in a recorded session back through handleReply.
+func replay(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	count, err := replaySession(f)
+	if err != nil {
+		return err
+	}
+	log.Printf("Replayed %d responses from %s", count, path)
+	return nil
+}
+
+// replaySession replays the records read from f and returns how many
+// there were.
+func replaySession(f io.Reader) (int, error) {
+	count, _, err := readSession(f, func(rec recordedReply) {
+		if rec.ttl > 0 {
+			recordTTL(rec.peer, rec.ttl)
+		}
+		if rec.rtt > 0 {
+			recordRTT(rec.peer, rec.rtt)
+		}
+		handleReply(rec.peer, rec.pkt)
+	})
+	return count, err
+}
+
+// readSessionVersion consumes the session header, if any, and returns
+// the format version of what follows.
+func readSessionVersion(r *bufio.Reader) (int, error) {
+	if magic, err := r.Peek(len(sessionMagic)); err != nil || string(magic) != sessionMagic {
+		return 1, nil // headerless: version 1, or too short to be anything
+	}
+	r.Discard(len(sessionMagic))
+	v, err := r.ReadByte()
+	if err != nil {
+		return 0, fmt.Errorf("session header: %w", err)
+	}
+	if v < 2 || v > sessionVersion {
+		return 0, fmt.Errorf("session format version %d is not supported (this scli reads 1 to %d)", v, sessionVersion)
+	}
+	return int(v), nil
+}
+
+// readSession calls fn for every record in a session of any supported
+// version, and returns the record count and the file's version.
+func readSession(f io.Reader, fn func(rec recordedReply)) (count, version int, err error) {
+	r := bufio.NewReader(f)
+	if version, err = readSessionVersion(r); err != nil {
+		return 0, 0, err
+	}
+	hdrLen := 9
+	if version >= 3 {
+		hdrLen = 18
+	}
+	for {
+		var hdr [18]byte
+		if _, err := io.ReadFull(r, hdr[:hdrLen]); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return count, version, fmt.Errorf("record %d: %w", count, err)
+		}
+		rec := recordedReply{at: int64(binary.BigEndian.Uint64(hdr[:8]))}
+		if version >= 3 {
+			rec.ttl = int(hdr[8])
+			rec.rtt = time.Duration(binary.BigEndian.Uint64(hdr[9:17]))
+		}
+		peer := make([]byte, hdr[hdrLen-1])
+		if _, err := io.ReadFull(r, peer); err != nil {
+			return count, version, fmt.Errorf("record %d: %w", count, err)
+		}
+		var n [2]byte
+		if _, err := io.ReadFull(r, n[:]); err != nil {
+			return count, version, fmt.Errorf("record %d: %w", count, err)
+		}
+		pkt := make([]byte, binary.BigEndian.Uint16(n[:]))
+		if _, err := io.ReadFull(r, pkt); err != nil {
+			return count, version, fmt.Errorf("record %d: %w", count, err)
+		}
+		if addr, err := netip.ParseAddr(string(peer)); err != nil || !addr.Is4() {
+			return count, version, fmt.Errorf("record %d: invalid peer address %q", count, peer)
+		}
+		rec.peer, rec.pkt = string(peer), pkt
+		fn(rec)
+		count++
+	}
+	return count, version, nil
+}
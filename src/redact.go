@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// redactKey is the per-run secret used to pseudonymize addresses.
+var redactKey = newRedactKey()
+
+func newRedactKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// redactIP pseudonymizes an IP address byte by byte. Each output byte
+// depends only on the bytes before it, so addresses that share a prefix
+// (e.g. the same /24, or fe80::/64) still share it after redaction.
+func redactIP(ipStr string) string {
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return ipStr
+	}
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	out := make(net.IP, len(ip))
+	for i := range ip {
+		mac := hmac.New(sha256.New, redactKey)
+		mac.Write(ip[:i])
+		out[i] = ip[i] ^ mac.Sum(nil)[0]
+	}
+	return out.String()
+}
+
+// redactName replaces a hostname with a stable pseudonym.
+func redactName(name string) string {
+	mac := hmac.New(sha256.New, redactKey)
+	mac.Write([]byte(name))
+	return "host-" + hex.EncodeToString(mac.Sum(nil)[:4])
+}
+
+// displayName returns the hostname as it should appear in output,
+// honoring --redact.
+func displayName(name string) string {
+	if *redact {
+		return redactName(name)
+	}
+	return name
+}
+
+// displayMAC returns the MAC as it should appear in output, honoring
+// --redact. Redaction keeps the OUI so the vendor stays visible and
+// pseudonymizes the device-specific half.
+func displayMAC(mac net.HardwareAddr) string {
+	if !*redact || len(mac) < 6 {
+		return mac.String()
+	}
+	h := hmac.New(sha256.New, redactKey)
+	h.Write(mac)
+	sum := h.Sum(nil)
+	out := append(net.HardwareAddr{}, mac...)
+	copy(out[3:6], sum[:3])
+	return out.String()
+}
+
+// display returns the IP as it should appear in output, honoring --redact.
+func display(ip string) string {
+	if *redact {
+		return redactIP(ip)
+	}
+	return ip
+}
+
+// displayHost returns a target as it should appear in output, honoring
+// --redact: addresses are pseudonymized as IPs, anything else as a name.
+func displayHost(host string) string {
+	if net.ParseIP(host) != nil {
+		return display(host)
+	}
+	return displayName(host)
+}
+
+// addrRE matches candidate IPv4 and IPv6 addresses in free text.
+var addrRE = regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}\b|[0-9A-Fa-f]{0,4}(?::[0-9A-Fa-f]{0,4}){2,7}`)
+
+// redactText pseudonymizes the addresses in a log message, and the names
+// targets were given as, when --redact is set. It is for messages built
+// from errors and other text that may quote a host; results use display
+// and displayName directly.
+func redactText(s string) string {
+	if !*redact {
+		return s
+	}
+	s = addrRE.ReplaceAllStringFunc(s, func(m string) string {
+		if net.ParseIP(m) == nil {
+			return m
+		}
+		return redactIP(m)
+	})
+	var pairs []string
+	for _, names := range targetNames {
+		for _, name := range names {
+			pairs = append(pairs, name, redactName(name))
+		}
+	}
+	if len(pairs) == 0 {
+		return s
+	}
+	return strings.NewReplacer(pairs...).Replace(s)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// maxReportedProblems caps how many messages of each kind the report
+// keeps, so a scan where every probe fails doesn't hold one per target.
+const maxReportedProblems = 100
+
+// scanReport collects what went wrong during a scan. Errors mean probes
+// never went out or replies may have been lost, so hosts can be missing
+// from the results. Warnings mean the scan ran degraded, e.g. slower or
+// with fewer probe methods, but probed everything it reports on.
+type scanReport struct {
+	mu           sync.Mutex
+	errors       []string
+	warnings     []string
+	errorCount   int
+	warningCount int
+}
+
+// report is the current scan's report.
+var report = &scanReport{}
+
+// scanError logs a probe failure and records it in the report. Hosts in
+// the message are redacted under --redact.
+func scanError(format string, args ...any) {
+	msg := redactText(fmt.Sprintf(format, args...))
+	log.Print(msg)
+	report.mu.Lock()
+	defer report.mu.Unlock()
+	report.errorCount++
+	if len(report.errors) < maxReportedProblems {
+		report.errors = append(report.errors, msg)
+	}
+}
+
+// scanWarning logs a degradation of the scan and records it in the report.
+func scanWarning(format string, args ...any) {
+	msg := redactText(fmt.Sprintf(format, args...))
+	log.Print(msg)
+	report.mu.Lock()
+	defer report.mu.Unlock()
+	report.warningCount++
+	if len(report.warnings) < maxReportedProblems {
+		report.warnings = append(report.warnings, msg)
+	}
+}
+
+// summarize logs how many errors and warnings the scan ran into, if any.
+func (r *scanReport) summarize() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case r.errorCount > 0:
+		log.Printf("Scan finished with %s and %s, some hosts may be missing", plural(r.errorCount, "error"), plural(r.warningCount, "warning"))
+	case r.warningCount > 0:
+		log.Printf("Scan finished with %s", plural(r.warningCount, "warning"))
+	}
+}
+
+// plural formats a count with a noun, e.g. "1 error" or "3 errors".
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScanReport(t *testing.T) {
+	resetScan(t)
+	buf := captureLog(t)
+	for i := 0; i < maxReportedProblems+50; i++ {
+		scanError("Error pinging 10.0.0.%d: boom", i)
+	}
+	scanWarning("Reducing send concurrency to 128 after: boom")
+	report.summarize()
+
+	if !strings.Contains(buf.String(), "Scan finished with 150 errors and 1 warning, some hosts may be missing\n") {
+		t.Error("log is missing the summary line")
+	}
+	mf := &manifest{}
+	mf.addReport(report)
+	if !mf.Partial || mf.ErrorCount != 150 || len(mf.Errors) != maxReportedProblems || mf.WarningCount != 1 {
+		t.Errorf("manifest report = partial %v, %d/%d errors, %d warnings", mf.Partial, len(mf.Errors), mf.ErrorCount, mf.WarningCount)
+	}
+	if mf.Errors[0] != "Error pinging 10.0.0.0: boom" {
+		t.Errorf("first error = %q", mf.Errors[0])
+	}
+}
+
+func TestScanReportClean(t *testing.T) {
+	resetScan(t)
+	buf := captureLog(t)
+	report.summarize()
+	mf := &manifest{}
+	mf.addReport(report)
+	if buf.Len() != 0 || mf.Partial {
+		t.Errorf("clean scan reported problems: %q, partial %v", buf.String(), mf.Partial)
+	}
+}
+
+// Under --redact, neither the log nor the manifest names a scanned host.
+func TestRedactedReportAndManifest(t *testing.T) {
+	resetScan(t)
+	buf := captureLog(t)
+	setFlag(t, redact, true)
+	targetNames[ipToInt("198.51.100.20")] = []string{"printer.lan"}
+	setFlag(t, &os.Args, []string{"scli", "--target", "printer.lan,198.51.100.0/28", "--first", "198.51.100.7"})
+
+	scanError("Error pinging %s: %s", "198.51.100.7", "sendto 198.51.100.7: no buffer space")
+	scanWarning("No route to printer.lan (2001:db8::1)")
+	mf := newManifest("198.51.100.0-198.51.100.15", time.Time{})
+	mf.addReport(report)
+	b, err := mf.marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, leak := range []string{"198.51.100.", "printer.lan", "2001:db8::1"} {
+		if strings.Contains(buf.String(), leak) || strings.Contains(string(b), leak) {
+			t.Errorf("%s leaked:\n%s\n%s", leak, buf, b)
+		}
+	}
+	if !strings.Contains(buf.String(), redactName("printer.lan")) {
+		t.Errorf("log doesn't name the redacted target:\n%s", buf)
+	}
+}
+
+func TestStatsLine(t *testing.T) {
+	// The limit shown is the limiter's, after any back-off
+	l := newLimiter(256)
+	l.limit = 128
+	setFlag(t, &sendLimiter, l)
+	prev := statsSnapshot{sent: 1000, replies: 10, timeouts: 4}
+	cur := statsSnapshot{sent: 3000, sendErrors: 2, replies: 30, timeouts: 24, inFlight: 128, queued: 60000}
+	want := "Stats: 3000 sent (1000/s), 2 send errors, 30 replies (10/s), 24 timeouts (10/s), 128 in flight (limit 128), 60000 queued"
+	if got := statsLine(prev, cur, 2*time.Second); got != want {
+		t.Errorf("statsLine =\n%s\nwant\n%s", got, want)
+	}
+	if got := statsLine(prev, cur, 0); !strings.Contains(got, "(0/s)") {
+		t.Errorf("statsLine with no elapsed time = %s", got)
+	}
+}
+
+// The isolation report names the protocols the peers answered over.
+func TestReportIsolationMethods(t *testing.T) {
+	resetScan(t)
+	buf := captureLog(t)
+	record("198.51.100.7", "arp")
+	record("198.51.100.20", "tcp")
+	if reportIsolation(results()) {
+		t.Fatal("isolation held with two peers answering")
+	}
+	for _, want := range []string{"2 peers reachable over ARP, TCP\n", "leak: 198.51.100.7 (via arp)\n"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("log is missing %q:\n%s", want, buf)
+		}
+	}
+}
+
+// The isolation test probes past ICMP whatever --discovery says.
+// This host's own addresses and its gateways may answer; anything else
+// is a leak.
+func TestIsolationLeaks(t *testing.T) {
+	self := "127.0.0.1"
+	gws := defaultGateways()
+	for _, tt := range []struct {
+		name  string
+		found []string
+		want  []string
+	}{
+		{"nobody", nil, nil},
+		{"only this host", []string{self}, nil},
+		{"only the gateways", gws, nil},
+		{"peers", append([]string{"198.51.100.7", self, "198.51.100.9"}, gws...), []string{"198.51.100.7", "198.51.100.9"}},
+	} {
+		if got := isolationLeaks(tt.found); !equalStrings(got, tt.want) {
+			t.Errorf("%s: leaks = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIsolationMethods(t *testing.T) {
+	got := sortedMethods(isolationMethods(map[string]bool{"icmp": true}))
+	want := []string{"icmp", "tcp"}
+	if featureEnabled("arp") && !termuxMode {
+		want = []string{"arp", "icmp", "tcp"}
+	}
+	if !equalStrings(got, want) {
+		t.Errorf("isolation methods = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"hash/fnv"
+	"net"
+	"net/netip"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// resultShard holds the hosts whose address hashes to it.
+type resultShard struct {
+	mu   sync.Mutex
+	seen map[string]string // the discovery method that found each host
+	macs map[string]net.HardwareAddr
+	ttls map[string]int
+	rtts map[string]time.Duration
+}
+
+// shards splits result aggregation so concurrent probes rarely contend.
+var shards = newShards(runtime.GOMAXPROCS(0) * 4)
+
+func newShards(n int) []*resultShard {
+	s := make([]*resultShard, n)
+	for i := range s {
+		s[i] = &resultShard{seen: make(map[string]string), macs: make(map[string]net.HardwareAddr), ttls: make(map[string]int), rtts: make(map[string]time.Duration)}
+	}
+	return s
+}
+
+func shardFor(ip string) *resultShard {
+	h := fnv.New32a()
+	h.Write([]byte(ip))
+	return shards[h.Sum32()%uint32(len(shards))]
+}
+
+// record stores ip with the method that found it and reports whether it
+// was new. Only the first method to find a host is kept.
+func record(ip, method string) bool {
+	s := shardFor(ip)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.seen[ip]; ok {
+		return false
+	}
+	s.seen[ip] = method
+	return true
+}
+
+// foundBy returns the discovery method that found ip, if it was found.
+func foundBy(ip string) string {
+	s := shardFor(ip)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.seen[ip]
+}
+
+// recordMAC stores the MAC address a host answered with during the scan.
+func recordMAC(ip string, mac net.HardwareAddr) {
+	s := shardFor(ip)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.macs[ip] = mac
+}
+
+// scannedMAC returns the MAC recorded for ip during the scan, if any.
+func scannedMAC(ip string) net.HardwareAddr {
+	s := shardFor(ip)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.macs[ip]
+}
+
+// recordTTL stores the IP TTL of the echo reply a host answered with.
+func recordTTL(ip string, ttl int) {
+	s := shardFor(ip)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ttls[ip] = ttl
+}
+
+// scannedTTL returns the reply TTL recorded for ip, or 0 if none was.
+func scannedTTL(ip string) int {
+	s := shardFor(ip)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ttls[ip]
+}
+
+// recordRTT stores a round-trip time measured for ip, keeping the
+// fastest when a host answers more than one probe.
+func recordRTT(ip string, rtt time.Duration) {
+	s := shardFor(ip)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.rtts[ip]; !ok || rtt < old {
+		s.rtts[ip] = rtt
+	}
+}
+
+// scannedRTT returns the round-trip time recorded for ip, or 0 if none was.
+func scannedRTT(ip string) time.Duration {
+	s := shardFor(ip)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rtts[ip]
+}
+
+// results returns every recorded IP, sorted numerically, IPv4 first.
+func results() []string {
+	var ips []string
+	for _, s := range shards {
+		s.mu.Lock()
+		for ip := range s.seen {
+			ips = append(ips, ip)
+		}
+		s.mu.Unlock()
+	}
+	sort.Slice(ips, func(i, j int) bool {
+		a, _ := netip.ParseAddr(ips[i])
+		b, _ := netip.ParseAddr(ips[j])
+		return a.Less(b)
+	})
+	return ips
+}
+
+// found reports whether ip has already been recorded as live.
+func found(ip string) bool {
+	s := shardFor(ip)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.seen[ip]
+	return ok
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// The synthetic hosts netnsHosts puts behind a veth pair. 198.18.0.0/15
+// is reserved for benchmarking, so it never clashes with a real network.
+const (
+	netnsLocal = "198.18.213.1"
+	netnsHostA = "198.18.213.2"
+	netnsHostB = "198.18.213.3"
+	netnsHostC = "198.18.213.4"
+)
+
+func requireLinux(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS != "linux" {
+		t.Skip("network namespaces are Linux only")
+	}
+}
+
+func TestScanICMPNetns(t *testing.T) {
+	requireLinux(t)
+	netnsHosts(t, netnsLocal, netnsHostA, netnsHostB, netnsHostC)
+	resetScan(t)
+	captureLog(t)
+	scanDeadline = time.Now().Add(2 * time.Second)
+
+	// .5 and .6 don't exist and must not show up
+	targets := mustTargets(t, "198.18.213.2-198.18.213.6")
+	if unprobed := scanICMP(targets, nil, true, false); unprobed != 0 {
+		t.Errorf("%d targets unprobed", unprobed)
+	}
+	want := []string{netnsHostA, netnsHostB, netnsHostC}
+	if got := results(); !equalStrings(got, want) {
+		t.Errorf("found %v, want %v", got, want)
+	}
+	if ttl := scannedTTL(netnsHostA); ttl != 64 && ttl != 0 {
+		t.Errorf("reply ttl = %d, want 64 (one hop into a namespace isn't routed)", ttl)
+	}
+}
+
+func TestScanICMPExcluded(t *testing.T) {
+	requireLinux(t)
+	netnsHosts(t, netnsLocal, netnsHostA, netnsHostB, netnsHostC)
+	resetScan(t)
+	captureLog(t)
+	scanDeadline = time.Now().Add(2 * time.Second)
+
+	targets := mustTargets(t, "198.18.213.2-198.18.213.4").subtract(mustTargets(t, netnsHostB))
+	scanICMP(targets, nil, true, false)
+	if got := results(); !equalStrings(got, []string{netnsHostA, netnsHostC}) {
+		t.Errorf("found %v, excluded host was probed", got)
+	}
+}
+
+// TestScanICMPUnprivileged pings loopback over datagram ICMP sockets,
+// which need no root where net.ipv4.ping_group_range allows them.
+func TestScanICMPUnprivileged(t *testing.T) {
+	c, err := icmp.ListenPacket("udp4", "127.0.0.1")
+	if err != nil {
+		t.Skipf("unprivileged ICMP unavailable: %s", err)
+	}
+	c.Close()
+	resetScan(t)
+	captureLog(t)
+	setFlag(t, icmpMode, "unprivileged")
+	setFlag(t, &unprivilegedICMP, false)
+	scanDeadline = time.Now().Add(2 * time.Second)
+
+	scanICMP(mustTargets(t, "127.0.0.1-127.0.0.3"), nil, true, false)
+	if got := results(); !equalStrings(got, []string{"127.0.0.1", "127.0.0.2", "127.0.0.3"}) {
+		t.Errorf("found %v", got)
+	}
+	if !unprivilegedICMP {
+		t.Error("unprivileged mode wasn't recorded")
+	}
+}
+
+// The namespace hosts have no listeners, so every probe is answered with
+// an RST, which counts as up just like a SYN/ACK.
+func TestScanTCPPingNetns(t *testing.T) {
+	requireLinux(t)
+	netnsHosts(t, netnsLocal, netnsHostA, netnsHostB)
+	for _, mode := range []string{"syn", "connect"} {
+		t.Run(mode, func(t *testing.T) {
+			resetScan(t)
+			captureLog(t)
+			setFlag(t, &unprivilegedICMP, mode == "connect")
+			scanTCPPing(mustTargets(t, "198.18.213.2-198.18.213.5"), nil, []int{80, 443})
+			if got, want := results(), []string{netnsHostA, netnsHostB}; !equalStrings(got, want) {
+				t.Errorf("found %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseDiscovery(t *testing.T) {
+	methods, err := parseDiscovery(" icmp,timestamp,,udp ")
+	if err != nil || len(methods) != 3 || !methods["timestamp"] {
+		t.Errorf("parseDiscovery = %v, %v", methods, err)
+	}
+	for _, bad := range []string{"", ",", "icmp,smoke-signals"} {
+		if _, err := parseDiscovery(bad); err == nil {
+			t.Errorf("parseDiscovery(%q) succeeded", bad)
+		}
+	}
+}
+
+// Termux has no raw sockets, so ARP is dropped from whatever was asked for.
+func TestApplyTermux(t *testing.T) {
+	captureLog(t)
+	setFlag(t, &unprivilegedICMP, false)
+	setFlag(t, mdnsScan, false)
+	for _, tt := range []struct{ discovery, want string }{
+		{"arp", "icmp"},
+		{"arp,tcp", "tcp"},
+		{"icmp,timestamp", "icmp,timestamp"},
+	} {
+		methods, err := parseDiscovery(tt.discovery)
+		if err != nil {
+			t.Fatal(err)
+		}
+		applyTermux(methods)
+		if got := strings.Join(sortedMethods(methods), ","); got != tt.want {
+			t.Errorf("--discovery %s on Termux = %s, want %s", tt.discovery, got, tt.want)
+		}
+	}
+	if !unprivilegedICMP || !*mdnsScan {
+		t.Errorf("unprivileged ICMP %v, mDNS %v, want both on", unprivilegedICMP, *mdnsScan)
+	}
+}
+
+// Each discovery method only probes targets earlier ones didn't find, and
+// the method that found a host is kept.
+func TestDiscoverNetns(t *testing.T) {
+	requireLinux(t)
+	netnsHosts(t, netnsLocal, netnsHostA, netnsHostB, netnsHostC)
+	resetScan(t)
+	captureLog(t)
+	scanDeadline = time.Now().Add(3 * time.Second)
+	record(netnsHostA, "arp") // as if an earlier pass found it
+
+	discover(mustTargets(t, "198.18.213.2-198.18.213.5"), nil, map[string]bool{"timestamp": true, "udp": true})
+	want := []string{netnsHostA, netnsHostB, netnsHostC}
+	if got := results(); !equalStrings(got, want) {
+		t.Errorf("found %v, want %v", got, want)
+	}
+	for ip, method := range map[string]string{netnsHostA: "arp", netnsHostB: "timestamp", netnsHostC: "timestamp"} {
+		if got := foundBy(ip); got != method {
+			t.Errorf("%s found by %q, want %q", ip, got, method)
+		}
+	}
+}
+
+func TestScanUDPPingNetns(t *testing.T) {
+	requireLinux(t)
+	netnsHosts(t, netnsLocal, netnsHostA)
+	resetScan(t)
+	captureLog(t)
+	scanUDPPing(mustTargets(t, "198.18.213.2-198.18.213.3"), nil, 40125)
+	if got := results(); !equalStrings(got, []string{netnsHostA}) || foundBy(netnsHostA) != "udp" {
+		t.Errorf("found %v via %q", got, foundBy(netnsHostA))
+	}
+}
+
+func TestScanARPNetns(t *testing.T) {
+	requireLinux(t)
+	iface := netnsHosts(t, netnsLocal, netnsHostA, netnsHostB)
+	if !featureEnabled("arp") {
+		t.Skip("built without ARP")
+	}
+	resetScan(t)
+	captureLog(t)
+
+	targets := mustTargets(t, "198.18.213.2-198.18.213.5")
+	if _, err := scanARP(iface, targets, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := results(); !equalStrings(got, []string{netnsHostA, netnsHostB}) {
+		t.Errorf("found %v", got)
+	}
+	if mac := scannedMAC(netnsHostA); mac == nil {
+		t.Errorf("no MAC recorded for %s", netnsHostA)
+	}
+}
+
+func TestScanIPv6Netns(t *testing.T) {
+	requireLinux(t)
+	iface := netnsHosts(t, netnsLocal, netnsHostA)
+	waitIPv6Ready(t, iface.Name)
+	resetScan(t)
+	captureLog(t)
+
+	if err := scanIPv6(iface); err != nil {
+		t.Fatal(err)
+	}
+	// Our own link-local address answers too; the namespace end must be
+	// found with its MAC from the neighbor cache
+	found := false
+	for _, ip := range results() {
+		if mac := scannedMAC(ip); mac != nil {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("no on-link IPv6 neighbor found: %v", results())
+	}
+}
+
+// waitIPv6Ready waits for duplicate address detection to finish on both
+// ends of the veth pair, so link-local addresses can answer.
+func waitIPv6Ready(t *testing.T, local string) {
+	t.Helper()
+	ns := "scli-test-" + local[len("sclia"):]
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		a, _ := exec.Command("ip", "-6", "addr", "show", "dev", local).Output()
+		b, _ := exec.Command("ip", "-n", ns, "-6", "addr").Output()
+		if bytes.Contains(a, []byte("fe80")) && !bytes.Contains(a, []byte("tentative")) &&
+			bytes.Contains(b, []byte("fe80")) && !bytes.Contains(b, []byte("tentative")) {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Skip("IPv6 link-local addresses never became usable")
+}
+
+func TestScanDeadlineSkipsTargets(t *testing.T) {
+	resetScan(t)
+	captureLog(t)
+	c := useFakeClock(t)
+	scanDeadline = c.Now().Add(2 * time.Second)
+
+	// Each probe takes a simulated second, so the deadline falls after the
+	// third target. Nothing is sent, so no socket is needed.
+	var probed int
+	forEachTarget(mustTargets(t, "10.0.0.0/30"), nil, func(ip uint32) {
+		if !pastDeadline() {
+			probed++
+		}
+		c.advance(time.Second)
+	})
+	if probed != 3 {
+		t.Errorf("%d targets probed before the deadline, want 3", probed)
+	}
+}
+
+// discardWriter stands in for the ICMP socket.
+type discardWriter struct{}
+
+func (discardWriter) WriteTo(b []byte, dst net.Addr) (int, error) { return len(b), nil }
+
+// Building and sending a probe allocates nothing on scli's side. The
+// socket write itself is measured by BenchmarkSendICMP.
+func TestSendICMPAllocs(t *testing.T) {
+	setFlag(t, &sendLimiter, newLimiter(4))
+	var dst probeAddr
+	ip := ipToInt("198.51.100.7")
+	for _, timestamp := range []bool{false, true} {
+		sendICMP(discardWriter{}, dst.set(ip), 1, timestamp) // warm packetPool
+		allocs := testing.AllocsPerRun(1000, func() {
+			if err := sendICMP(discardWriter{}, dst.set(ip), 1, timestamp); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if allocs != 0 {
+			t.Errorf("sendICMP (timestamp %v) allocates %v times per probe, want 0", timestamp, allocs)
+		}
+	}
+}
+
+// batchRecorder stands in for the ICMP socket's WriteBatch. Each call
+// takes at most max messages and fails with the next of errs, if any.
+type batchRecorder struct {
+	max  int
+	errs []error
+	sent []string
+}
+
+func (b *batchRecorder) WriteBatch(ms []ipv4.Message, flags int) (int, error) {
+	if len(b.errs) > 0 {
+		err := b.errs[0]
+		b.errs = b.errs[1:]
+		if err != nil {
+			return 0, err
+		}
+	}
+	n := min(len(ms), b.max)
+	for _, m := range ms[:n] {
+		b.sent = append(b.sent, m.Addr.String())
+	}
+	return n, nil
+}
+
+// A batch goes out over as many calls as the socket needs. Resource
+// errors are retried, while any other error drops only the probe it hit.
+func TestICMPSenderBatch(t *testing.T) {
+	if icmpBatch == 1 {
+		t.Skip("no batched sends on this OS")
+	}
+	resetScan(t)
+	captureLog(t)
+	setFlag(t, &sendLimiter, newLimiter(4))
+	setFlag(t, &unprivilegedICMP, false)
+	w := &batchRecorder{max: 2, errs: []error{nil, syscall.ENOBUFS, syscall.EHOSTUNREACH}}
+	s := newICMPSender(nil, w)
+	ips := mustTargets(t, "198.51.100.1-198.51.100.5")
+	var batch []uint32
+	forEachTarget(ips, nil, func(ip uint32) { batch = append(batch, ip) })
+
+	s.send(batch, false)
+	want := []string{"198.51.100.1", "198.51.100.2", "198.51.100.4", "198.51.100.5"}
+	if !equalStrings(w.sent, want) {
+		t.Errorf("sent to %v, want %v", w.sent, want)
+	}
+	if got := report.errorCount; got != 1 {
+		t.Errorf("%d send errors reported, want 1", got)
+	}
+}
+
+// BenchmarkSendICMP sends echo requests to loopback over a raw socket.
+func BenchmarkSendICMP(b *testing.B) {
+	c, err := icmp.ListenPacket("ip4:icmp", "127.0.0.1")
+	if err != nil {
+		b.Skipf("needs a raw ICMP socket: %s", err)
+	}
+	defer c.Close()
+	old := sendLimiter
+	sendLimiter = newLimiter(4)
+	defer func() { sendLimiter = old }()
+	var dst probeAddr
+	ip := ipToInt("127.0.0.1")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := sendICMP(c, dst.set(ip), i, false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+)
+
+// Files scli writes and may read back later carry a format version, so a
+// newer scli can upgrade what an older one stored:
+//
+//	session files (--record)  sessionVersion, in a binary header
+//	manifests (--manifest)    manifestVersion, as "schema_version"
+//
+// Replay reads every older session version as is. "scli migrate" rewrites
+// old files in the current format. The pb output needs no version: its
+// fields are only ever added, never renumbered (see proto/scli.proto).
+
+// manifestVersion is the manifest schema this binary writes. Version 1
+// manifests predate the field and lack partial, errors and warnings;
+// version 2 lacks oui.
+const manifestVersion = 3
+
+// runMigrate implements "scli migrate <file>...": it upgrades each session
+// file or manifest to the current format in place.
+func runMigrate(paths []string) error {
+	if len(paths) == 0 {
+		return errors.New("usage: scli migrate <session or manifest file>...")
+	}
+	failed := false
+	for _, path := range paths {
+		from, to, err := migrateFile(path)
+		switch {
+		case err != nil:
+			log.Printf("Error migrating %s: %s", path, err)
+			failed = true
+		case from == to:
+			log.Printf("%s is already version %d", path, to)
+		default:
+			log.Printf("Migrated %s from version %d to %d", path, from, to)
+		}
+	}
+	if failed {
+		return errors.New("some files could not be migrated")
+	}
+	return nil
+}
+
+// migrateFile upgrades the session file or manifest at path and returns
+// the versions it migrated between. Files already current are untouched.
+func migrateFile(path string) (from, to int, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	var out []byte
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		from, to, out, err = migrateManifest(data)
+	} else {
+		from, to, out, err = migrateSession(data)
+	}
+	if err != nil || from == to {
+		return from, to, err
+	}
+	return from, to, writeFileAtomic(path, out, info.Mode().Perm())
+}
+
+// migrateSession upgrades a session file. Version 1 lacked the header and
+// versions 1 and 2 the per-record TTL and RTT, so every record is
+// rewritten with both unmeasured.
+func migrateSession(data []byte) (from, to int, out []byte, err error) {
+	var recs []recordedReply
+	_, from, err = readSession(bytes.NewReader(data), func(rec recordedReply) {
+		recs = append(recs, rec)
+	})
+	if err != nil {
+		return from, sessionVersion, nil, err
+	}
+	if from == sessionVersion {
+		return from, from, nil, nil
+	}
+	out = append([]byte(sessionMagic), sessionVersion)
+	for _, rec := range recs {
+		out = appendRecord(out, rec)
+	}
+	return from, sessionVersion, out, nil
+}
+
+// migrateManifest upgrades a manifest. Version 1 recorded unprobed
+// targets but not probe errors, so partial is derived from the unprobed
+// count and the unknown error and warning counts are left out. Which OUI
+// table versions 1 and 2 used isn't known, so oui stays out too.
+func migrateManifest(data []byte) (from, to int, out []byte, err error) {
+	var mf manifest
+	if err := json.Unmarshal(data, &mf); err != nil {
+		return 0, manifestVersion, nil, fmt.Errorf("not a manifest: %w", err)
+	}
+	from = mf.SchemaVersion
+	if from == 0 {
+		from = 1
+	}
+	switch {
+	case from > manifestVersion:
+		return from, manifestVersion, nil, fmt.Errorf("manifest version %d is newer than this scli supports (%d)", from, manifestVersion)
+	case from == manifestVersion:
+		return from, from, nil, nil
+	}
+	mf.SchemaVersion = manifestVersion
+	if from == 1 {
+		mf.Partial = mf.Unprobed > 0
+	}
+	out, err = mf.marshal()
+	return from, manifestVersion, out, err
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sessionReply is an echo reply to store in test sessions.
+var sessionReply = []byte{0, 0, 0xff, 0xfe, 0, 1, 0, 1}
+
+func TestMigrateSession(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scan.rec")
+	v1 := append(sessionRecord("10.0.0.1", sessionReply), sessionRecord("10.0.0.2", sessionReply)...)
+	if err := os.WriteFile(path, v1, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if from, to, err := migrateFile(path); err != nil || from != 1 || to != sessionVersion {
+		t.Fatalf("migrateFile = %d, %d, %v", from, to, err)
+	}
+	data, _ := os.ReadFile(path)
+	want := append([]byte(sessionMagic), sessionVersion)
+	want = appendRecord(want, recordedReply{peer: "10.0.0.1", pkt: sessionReply})
+	want = appendRecord(want, recordedReply{peer: "10.0.0.2", pkt: sessionReply})
+	if !bytes.Equal(data, want) {
+		t.Errorf("migrated file = %q\nwant %q", data, want)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o600 {
+		t.Errorf("migration changed the file mode to %v", info.Mode().Perm())
+	}
+
+	// Both versions replay the same hosts, and current files are left alone
+	for _, session := range [][]byte{v1, data} {
+		resetScan(t)
+		captureLog(t)
+		if n, err := replaySession(bytes.NewReader(session)); n != 2 || err != nil {
+			t.Errorf("replaySession = %d, %v", n, err)
+		}
+	}
+	if from, to, err := migrateFile(path); err != nil || from != to {
+		t.Errorf("second migration = %d, %d, %v", from, to, err)
+	}
+}
+
+// Replay restores the TTL and RTT measured when the reply was recorded.
+func TestReplaySessionTTLAndRTT(t *testing.T) {
+	session := append([]byte(sessionMagic), sessionVersion)
+	session = appendRecord(session, recordedReply{peer: "10.0.0.1", ttl: 64, rtt: 3 * time.Millisecond, pkt: sessionReply})
+	session = appendRecord(session, recordedReply{peer: "10.0.0.2", pkt: sessionReply})
+	resetScan(t)
+	captureLog(t)
+	if n, err := replaySession(bytes.NewReader(session)); n != 2 || err != nil {
+		t.Fatalf("replaySession = %d, %v", n, err)
+	}
+	if ttl, rtt := scannedTTL("10.0.0.1"), scannedRTT("10.0.0.1"); ttl != 64 || rtt != 3*time.Millisecond {
+		t.Errorf("10.0.0.1: TTL %d, RTT %v", ttl, rtt)
+	}
+	if ttl, rtt := scannedTTL("10.0.0.2"), scannedRTT("10.0.0.2"); ttl != 0 || rtt != 0 {
+		t.Errorf("10.0.0.2: TTL %d, RTT %v, want neither", ttl, rtt)
+	}
+}
+
+func TestMigrateSessionRejects(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"newer version": []byte(sessionMagic + "\x09"),
+		"corrupt":       sessionRecord("not-an-ip", sessionReply),
+	} {
+		path := filepath.Join(t.TempDir(), "scan.rec")
+		os.WriteFile(path, data, 0o644)
+		if _, _, err := migrateFile(path); err == nil {
+			t.Errorf("%s: migrated", name)
+		}
+		if got, _ := os.ReadFile(path); !bytes.Equal(got, data) {
+			t.Errorf("%s: failed migration modified the file", name)
+		}
+	}
+}
+
+func TestMigrateManifest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scan.json")
+	v1 := `{"tool": "scli", "version": "v0.9.0", "targets": "10.0.0.0/24", "hosts_found": 3, "unprobed": 12, "started_at": "2024-01-02T03:04:05Z"}`
+	os.WriteFile(path, []byte(v1), 0o644)
+	if from, to, err := migrateFile(path); err != nil || from != 1 || to != manifestVersion {
+		t.Fatalf("migrateFile = %d, %d, %v", from, to, err)
+	}
+
+	data, _ := os.ReadFile(path)
+	var mf manifest
+	if err := json.Unmarshal(data, &mf); err != nil {
+		t.Fatal(err)
+	}
+	if mf.SchemaVersion != manifestVersion || !mf.Partial || mf.HostsFound != 3 || mf.Targets != "10.0.0.0/24" {
+		t.Errorf("migrated manifest = %+v", mf)
+	}
+	if strings.Contains(string(data), "error_count") || strings.Contains(string(data), `"oui"`) {
+		t.Error("migration invented an error count or OUI table v1 never recorded")
+	}
+
+	// Version 2 keeps the partial flag it derived from errors
+	v2 := `{"schema_version": 2, "tool": "scli", "unprobed": 0, "partial": true, "error_count": 1}`
+	os.WriteFile(path, []byte(v2), 0o644)
+	if from, to, err := migrateFile(path); err != nil || from != 2 || to != manifestVersion {
+		t.Fatalf("migrateFile v2 = %d, %d, %v", from, to, err)
+	}
+	data, _ = os.ReadFile(path)
+	mf = manifest{}
+	if err := json.Unmarshal(data, &mf); err != nil || !mf.Partial || mf.ErrorCount != 1 || mf.OUI != nil {
+		t.Errorf("migrated v2 manifest = %+v, %v", mf, err)
+	}
+
+	os.WriteFile(path, []byte(`{"schema_version": 99}`), 0o644)
+	if _, _, err := migrateFile(path); err == nil {
+		t.Error("migrated a manifest from a newer scli")
+	}
+}
+
+// The manifest names the OUI table the vendor names came from.
+func TestManifestOUI(t *testing.T) {
+	oui := newManifest("10.0.0.0/24", time.Now()).OUI
+	if oui == nil || oui.Entries != len(ouiVendors) || oui.Entries == 0 || len(oui.SHA256) != 64 {
+		t.Errorf("manifest oui = %+v", oui)
+	}
+}
+
+func TestCheckRecord(t *testing.T) {
+	resetScan(t)
+	buf := captureLog(t)
+	setFlag(t, recordPath, "scan.rec")
+	if err := checkRecord(map[string]bool{"icmp": true}, nil); err != nil || buf.Len() != 0 {
+		t.Errorf("ICMP-only scan: %v, logged %q", err, buf)
+	}
+	if err := checkRecord(map[string]bool{"arp": true, "tcp": true}, nil); err == nil {
+		t.Error("recording a scan without ICMP probes was allowed")
+	}
+	if err := checkRecord(map[string]bool{"icmp": true, "tcp": true, "udp": true}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "not tcp, udp") {
+		t.Errorf("no warning about the unrecorded methods: %q", buf)
+	}
+}
@@ -2,190 +2,722 @@ package main
 
 import (
 	"bufio"
+	"encoding/binary"
+	"flag"
 	"fmt"
 	"log"
+	"math/rand"
 	"net"
 	"os"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"golang.org/x/net/icmp"
-	"golang.org/x/net/ipv4"
 )
 
-var m = make(map[string]bool)
-var a = []string{}
+var ifaceName = flag.String("interface", "", "scan the subnet of this network interface (e.g. eth0)")
+var scanRange = flag.String("range", "", "scan this IP range or CIDR block (e.g. 192.168.1.1-192.168.1.254 or 10.0.0.0/22)")
+var targetFile = flag.String("target-file", "", "read targets from this file, one per line ('-' for stdin)")
+var excludeFile = flag.String("exclude-file", "", "read targets to skip from this file, one per line")
+var targetFlags stringList
+var excludeFlags stringList
+
+func init() {
+	flag.StringVar(output, "format", "text", "same as --output; overrides the format -o infers from the file extension")
+	flag.Var(&targetFlags, "target", "target to scan: IP, range, CIDR, octet pattern (10.0.1-3.*) or hostname; comma-separated and repeatable")
+	flag.Var(&excludeFlags, "exclude", "target never to probe: IP, range, CIDR or hostname; comma-separated and repeatable")
+}
+
+var redact = flag.Bool("redact", false, "pseudonymize IPs in the output so results can be shared")
+var deadline = flag.Duration("deadline", 0, "stop probing after this long and report partial results (e.g. 90s)")
+var seed = flag.Int64("seed", 0, "seed for ICMP IDs, SYN source ports and sequence numbers so a scan can be reproduced (0 picks them at random, with ICMP IDs from the process ID)")
+var firstTargets = flag.String("first", "", "comma-separated targets to probe before the rest: anything --range takes, or gateway")
+var recordPath = flag.String("record", "", "record every raw ICMP reply to this file for later replay (other discovery methods and port scans aren't recorded)")
+var isolationTest = flag.Bool("isolation-test", false, "verify client isolation: probe with ARP, ICMP and TCP whatever --discovery says, and fail if any peer other than the gateway answers")
+var concurrency = flag.Int("concurrency", 256, "maximum probes sent at once; lowered automatically on socket resource errors")
+var sndbuf = flag.Int("sndbuf", 0, "socket send buffer size in bytes (0 sizes it from the target count)")
+var rcvbuf = flag.Int("rcvbuf", 0, "socket receive buffer size in bytes (0 sizes it from the target count)")
+var rdns = flag.Bool("rdns", true, "resolve the PTR name of every live host")
+var rdnsConcurrency = flag.Int("rdns-concurrency", 16, "parallel reverse DNS queries")
+var rdnsTimeout = flag.Duration("rdns-timeout", 2*time.Second, "timeout for each reverse DNS query")
+var arpScan = flag.Bool("arp", false, "discover hosts on the local segment with ARP instead of ICMP (Linux, macOS and the BSDs); same as --discovery arp")
+var output = flag.String("output", "text", "result format: text, pb (length-delimited protobuf on stdout), csv (on stdout), ndjson (one JSON object per host on stdout, streamed as hosts are found) or grep (one line of tab-separated fields per host on stdout)")
+var outFile = flag.String("o", "", "write the results to this file instead of stdout, in the format its extension implies (.txt, .pb, .csv, .json/.ndjson, .gnmap) unless --format is given; the file is replaced atomically once the scan is done")
+var mdnsScan = flag.Bool("mdns", false, "also discover hosts that answer multicast DNS on the local segment")
+var allInterfaces = flag.Bool("all-interfaces", false, "list every interface in the wizard, including peer-to-peer ones such as macOS awdl/llw")
+var ipv6Scan = flag.Bool("ipv6", false, "discover on-link IPv6 hosts on --interface by pinging ff02::1 and ff02::2 and reading the neighbor cache")
+var icmpMode = flag.String("icmp", "auto", "ICMP socket: raw (needs root or CAP_NET_RAW), unprivileged (datagram ICMP, Linux and macOS) or auto (raw, falling back to unprivileged)")
+var discovery = flag.String("discovery", "icmp", "host discovery probes, comma-separated: icmp (echo), timestamp (ICMP timestamp), arp, tcp (--tcp-ping ports, default 80,443) and udp (--udp-ping-port); any answer marks a host up")
+var tcpPing = flag.String("tcp-ping", "", "also probe hosts that don't answer on these TCP ports, e.g. 80,443 (SYN/ACK or RST means up; SYNs as root, connects otherwise)")
+var udpPingPort = flag.Int("udp-ping-port", 40125, "UDP port probed by --discovery udp; a closed port draws an ICMP port unreachable")
+var statsInterval = flag.Duration("stats", 0, "log probe engine stats (sent, replies, timeouts, in flight, queued) at this interval, e.g. 2s")
+var lowMemory = flag.Bool("low-memory", false, "lower concurrency, buffer sizes and retained state for router-class devices")
+var manifestPath = flag.String("manifest", "", "write a JSON provenance manifest for the scan to this file")
+
+// targetNames maps addresses given as hostnames back to those names.
+var targetNames = make(map[uint32][]string)
+
+// idBase is the first ICMP echo ID; each probe adds its sequence number.
+var idBase int
+
+// probeRand draws the random values probes carry: the ICMP ID base, SYN
+// source ports and sequence numbers. --seed reseeds it so they repeat.
+var probeRand = struct {
+	sync.Mutex
+	r *rand.Rand
+}{r: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// probeIntn returns a random int in [0, n) from probeRand.
+func probeIntn(n int) int {
+	probeRand.Lock()
+	defer probeRand.Unlock()
+	return probeRand.r.Intn(n)
+}
+
+// probeUint32 returns a random uint32 from probeRand.
+func probeUint32() uint32 {
+	probeRand.Lock()
+	defer probeRand.Unlock()
+	return probeRand.r.Uint32()
+}
+
+// sendLimiter bounds concurrent sends and connects, backing off on ENOBUFS
+// and friends. main remakes it once the flags are parsed.
+var sendLimiter = newLimiter(*concurrency)
 
-// Add IP to the list only if not already added
-func add(s string) {
-	if m[s] {
-		return // Already in the map
+// unprivilegedICMP pings over a datagram ICMP socket ("udp4"), which
+// doesn't need root where the OS allows it, such as Android and macOS.
+// It is set by --icmp unprivileged, by Android detection, or when auto
+// mode falls back after a permission error.
+var unprivilegedICMP bool
+
+// scanDeadline is the hard stop for the scan; zero means no deadline.
+var scanDeadline time.Time
+
+// Add IP to the list only if not already added, noting the discovery
+// method that found it
+func add(s, method string) {
+	if !record(s, method) {
+		return // Already recorded
+	}
+	log.Printf("Found IP: %s", display(s))
+	if *output == "ndjson" && *outFile == "" {
+		streamHost(s)
 	}
-	a = append(a, s)
-	m[s] = true
-	log.Printf("Found IP: %s", s)
 }
 
 func main() {
-	// List all available network interfaces
-	interfaces, err := net.Interfaces()
+	flag.Parse()
+	args := flag.Args()
+	if len(args) > 2 && args[0] == "replay" {
+		// Output flags may follow the session file, as they follow
+		// "ports" and "verify": scli replay scan.rec --output json
+		flag.CommandLine.Parse(args[2:])
+		args = append(args[:2:2], flag.Args()...)
+	}
+	command := ""
+	if len(args) > 0 {
+		command = args[0]
+	}
+	if *outFile != "" && !flagSet(flag.CommandLine, "output") && !flagSet(flag.CommandLine, "format") {
+		format, err := formatForPath(*outFile)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		*output = format
+	}
+	switch *output {
+	case "text", "pb", "csv", "ndjson", "grep":
+	default:
+		log.Fatalf("Unknown output format %q", *output)
+	}
+	if *icmpMode != "auto" && *icmpMode != "raw" && *icmpMode != "unprivileged" {
+		log.Fatalf("Unknown --icmp mode %q", *icmpMode)
+	}
+	if *sndbuf < 0 || *rcvbuf < 0 {
+		log.Fatalf("--sndbuf and --rcvbuf take a size in bytes, or 0 to size them from the target count")
+	}
+	if *lowMemory {
+		applyLowMemory()
+	}
+	methods, err := parseDiscovery(*discovery)
 	if err != nil {
-		log.Fatalf("Error getting interfaces: %s", err)
+		log.Fatalf("Error parsing --discovery: %s", err)
+	}
+	if *arpScan && !flagSet(flag.CommandLine, "discovery") {
+		methods = map[string]bool{"arp": true}
+	}
+	if *tcpPing != "" {
+		if tcpPingPorts, err = parsePortSpec(*tcpPing, "tcp"); err != nil {
+			log.Fatalf("Error parsing --tcp-ping: %s", err)
+		}
+		methods["tcp"] = true
+	}
+	if *isolationTest {
+		// A peer that ignores pings can still leak over ARP or TCP
+		methods = isolationMethods(methods)
+	}
+	if termuxMode {
+		applyTermux(methods)
+	}
+	if *isolationTest {
+		log.Printf("Isolation test: probing with %s", strings.Join(sortedMethods(methods), ", "))
+	}
+	idBase = os.Getpid() & 0xffff
+	if *seed != 0 {
+		probeRand.r = rand.New(rand.NewSource(*seed))
+		idBase = probeIntn(0x10000)
+		log.Printf("Using seed %d", *seed)
+	}
+	sendLimiter = newLimiter(*concurrency)
+
+	var expect *expectations
+	var ports *portScan
+	switch command {
+	case "replay":
+		// scli replay <session> re-runs recorded responses instead of scanning
+		if len(args) != 2 {
+			log.Fatalf("Usage: scli [flags] replay <session file> [flags]")
+		}
+		if err := replay(args[1]); err != nil {
+			log.Fatalf("Error replaying %s: %s", args[1], err)
+		}
+		replaying = true
+		printResults()
+		return
+	case "version":
+		if err := runVersion(args[1:]); err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		return
+	case "migrate":
+		// scli migrate <file>... upgrades stored sessions and manifests
+		if err := runMigrate(args[1:]); err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		return
+	case "verify":
+		// scli verify runs a normal scan, then checks the results
+		var err error
+		expect, err = parseVerifyArgs(args[1:])
+		if err != nil {
+			log.Fatalf("Error parsing verify arguments: %s", err)
+		}
+	case "ports":
+		// scli ports scans TCP ports on live hosts, or directly on the
+		// targets given after it
+		var err error
+		ports, err = parsePortArgs(args[1:])
+		if err != nil {
+			log.Fatalf("Error parsing ports arguments: %s", err)
+		}
+	case "":
+	default:
+		log.Fatalf("Unknown command %q", command)
 	}
 
-	fmt.Println("Available network interfaces:")
-	for idx, iface := range interfaces {
-		fmt.Printf("[%d] %s (%s)\n", idx, iface.Name, iface.HardwareAddr.String())
+	if err := checkRecord(methods, ports); err != nil {
+		log.Fatalf("Error: %s", err)
 	}
 
-	// Ask user to select an interface
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Print("Select the interface number you want to scan (or press Enter for custom IP range): ")
-	input, _ := reader.ReadString('\n')
-	input = strings.TrimSpace(input)
+	// IPv6 discovery works per link rather than over a target range
+	if *ipv6Scan {
+		if *ifaceName == "" || ports != nil {
+			log.Fatalf("--ipv6 needs --interface and can't be combined with a port scan")
+		}
+		iface, err := net.InterfaceByName(*ifaceName)
+		if err != nil {
+			log.Fatalf("Error getting interface: %s", err)
+		}
+		if err := scanIPv6(iface); err != nil {
+			log.Fatalf("Error running IPv6 discovery: %s", err)
+		}
+		printResults()
+		if expect != nil && !expect.check(results()) {
+			os.Exit(1)
+		}
+		return
+	}
 
-	var ipRange string
-	if input == "" {
-		// Custom IP range
-		fmt.Print("Enter custom IP range (e.g., 192.168.1.1-192.168.1.254): ")
-		ipRange, _ = reader.ReadString('\n')
-		ipRange = strings.TrimSpace(ipRange)
-	} else {
-		// Scan IPs on the selected interface's subnet
-		interfaceIndex, _ := strconv.Atoi(input)
-		selectedInterface := interfaces[interfaceIndex]
-		addrs, err := selectedInterface.Addrs()
+	// Flags pick the targets directly; the wizard only runs without them
+	exprs := append([]string(nil), targetFlags...)
+	if *scanRange != "" {
+		exprs = append(exprs, *scanRange)
+	}
+	if *targetFile != "" {
+		lines, err := readTargetFile(*targetFile)
 		if err != nil {
-			log.Fatalf("Error getting addresses: %s", err)
+			log.Fatalf("Error reading target file: %s", err)
 		}
+		exprs = append(exprs, lines...)
+	}
+	if *ifaceName != "" {
+		iface, err := net.InterfaceByName(*ifaceName)
+		if err != nil {
+			log.Fatalf("Error getting interface %s: %s", *ifaceName, err)
+		}
+		exprs = append(exprs, interfaceRange(iface))
+	}
+	directPorts := ports != nil && len(ports.targets) > 0
+	if directPorts {
+		exprs = append(exprs, ports.targets...)
+	}
+	if len(exprs) == 0 {
+		exprs = append(exprs, promptRange())
+	}
 
-		// Look for the first valid IPv4 address and parse it
-		for _, addr := range addrs {
-			ip, ipNet, err := net.ParseCIDR(addr.String())
-			if err == nil && ip.To4() != nil {
-				ipRange = getIPRange(ipNet)
-				fmt.Printf("Scanning range: %s\n", ipRange)
-				break
-			}
+	// Parse and merge targets
+	targets, err := parseTargets(exprs, targetNames)
+	if err != nil {
+		log.Fatalf("Error parsing target: %s", err)
+	}
+
+	// Drop exclusions before anything is sent
+	excludes := append([]string(nil), excludeFlags...)
+	if *excludeFile != "" {
+		lines, err := readTargetFile(*excludeFile)
+		if err != nil {
+			log.Fatalf("Error reading exclude file: %s", err)
 		}
+		excludes = append(excludes, lines...)
+	}
+	excluded, err := parseTargets(excludes, nil)
+	if err != nil {
+		log.Fatalf("Error parsing exclusion: %s", err)
+	}
+	targets = targets.subtract(excluded)
+	if len(targets) == 0 {
+		log.Fatalf("No targets to scan")
+	}
 
-		if ipRange == "" {
-			log.Fatalf("No valid IPv4 address found for interface %s", selectedInterface.Name)
+	log.Printf("Starting Scan...")
+	started := scanClock.Now()
+	if *deadline > 0 {
+		scanDeadline = scanClock.Now().Add(*deadline)
+	}
+
+	handlePauseSignals()
+	if *statsInterval > 0 {
+		statsDone := make(chan struct{})
+		defer close(statsDone)
+		go reportStats(*statsInterval, statsDone)
+	}
+
+	// Priority targets go out before the rest of the targets
+	first, err := parseFirst(*firstTargets, targets)
+	if err != nil {
+		log.Fatalf("Error parsing --first: %s", err)
+	}
+
+	var unprobed int64
+	switch {
+	case directPorts:
+		// Explicit port scan targets skip host discovery
+		var ips []string
+		forEachTarget(targets, first, func(ip uint32) { ips = append(ips, intToIP(ip)) })
+		ports.scan(ips)
+	default:
+		unprobed = discover(targets, first, methods)
+	}
+	if *mdnsScan && !directPorts {
+		if err := scanMDNS(targets); err != nil {
+			scanError("Error running mDNS discovery: %s", err)
 		}
 	}
+	if ports != nil && !directPorts {
+		ports.scan(results())
+	}
 
-	// Parse IP range
-	startIP, endIP := parseIPRange(ipRange)
+	if unprobed > 0 {
+		log.Printf("Deadline reached: %d targets unprobed, results are partial", unprobed)
+	}
+	report.summarize()
+
+	printResults()
+
+	if *manifestPath != "" {
+		mf := newManifest(targets.String(), started)
+		mf.FinishedAt = scanClock.Now()
+		mf.HostsFound = len(results())
+		mf.Unprobed = unprobed
+		mf.addReport(report)
+		if err := mf.write(*manifestPath); err != nil {
+			log.Printf("Error writing manifest: %s", err)
+		}
+	}
 
-	log.Printf("Starting Scan...")
+	if *isolationTest && !reportIsolation(results()) {
+		os.Exit(1)
+	}
+	if expect != nil && !expect.check(results()) {
+		os.Exit(1)
+	}
+}
+
+// icmpWait is how long to keep listening for ICMP replies after the last
+// request has been sent.
+const icmpWait = 3 * time.Second
 
+// scanICMP sends echo and/or timestamp requests to every target that
+// hasn't been found yet over one shared ICMP socket, and returns how many
+// targets were left unprobed when the deadline hit. A single receiver
+// reads every reply, so none is lost to a prober waiting on another host.
+func scanICMP(targets targetSet, first []uint32, echo, timestamp bool) int64 {
 	// Open ICMP connection
-	c, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+	c, err := listenICMP("ip4:icmp", "udp4", "0.0.0.0")
 	if err != nil {
 		log.Fatalf("Error creating connection: %s", err)
 	}
 	defer c.Close()
+	if timestamp && unprivilegedICMP {
+		// Datagram ICMP sockets only carry echo requests
+		scanWarning("ICMP timestamp probes need a raw socket, skipping them")
+		if timestamp = false; !echo {
+			return 0
+		}
+	}
 
-	var wg sync.WaitGroup
+	setSockBufs(c, targets.count(), *sndbuf, *rcvbuf)
 
-	for ip := ipToInt(startIP); ip <= ipToInt(endIP); ip++ {
+	if *recordPath != "" {
+		sessionRecorder, err = openRecorder(*recordPath)
+		if err != nil {
+			log.Fatalf("Error creating record file: %s", err)
+		}
+		defer func() {
+			if err := sessionRecorder.Close(); err != nil {
+				scanError("Error writing record file: %s", err)
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	var recv sync.WaitGroup
+	recv.Add(1)
+	go func() {
+		defer recv.Done()
+		receiveICMP(c, targets, done)
+	}()
+
+	// Targets go to the senders icmpBatch at a time; each batch slice
+	// returns through free once it has been sent
+	workers := max(*concurrency, 1)
+	jobs := make(chan []uint32)
+	free := make(chan []uint32, workers+1)
+	for i := 0; i < workers+1; i++ {
+		free <- make([]uint32, 0, icmpBatch)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
 		wg.Add(1)
-		go func(ip int) {
+		go func() {
 			defer wg.Done()
-			targetIP := intToIP(ip)
-			if err := ping(c, targetIP, ip); err != nil {
-				log.Printf("Error pinging %s: %s", targetIP, err)
+			s := newICMPSender(c, c.IPv4PacketConn())
+			for ips := range jobs {
+				if echo {
+					s.send(ips, false)
+				}
+				if timestamp {
+					s.send(ips, true)
+				}
+				free <- ips[:0]
 			}
-		}(ip)
+		}()
 	}
 
+	var unprobed int64
+	batch := <-free
+	forEachTarget(targets, first, func(ip uint32) {
+		if found(intToIP(ip)) {
+			return
+		}
+		scanGate.wait()
+		if pastDeadline() {
+			unprobed++
+			return
+		}
+		if batch = append(batch, ip); len(batch) == icmpBatch {
+			jobs <- batch
+			batch = <-free
+		}
+	})
+	if len(batch) > 0 {
+		jobs <- batch
+	}
+	close(jobs)
 	wg.Wait()
 
-	// Sort IPs correctly
-	sort.Slice(a, func(i, j int) bool {
-		return ipToInt(a[i]) < ipToInt(a[j])
-	})
+	settle(icmpWait)
+	close(done)
+	recv.Wait()
+	return unprobed
+}
+
+// promptRange runs the interactive wizard: list interfaces, then scan the
+// chosen one's subnet or a custom range typed by the user.
+func promptRange() string {
+	// List all available network interfaces
+	all, err := net.Interfaces()
+	if err != nil {
+		log.Fatalf("Error getting interfaces: %s", err)
+	}
+	var interfaces []net.Interface
+	for _, iface := range all {
+		if *allInterfaces || !hiddenInterface(iface) {
+			interfaces = append(interfaces, iface)
+		}
+	}
 
-	log.Printf("Unique IPs: %v", len(a))
-	log.Println("List of IPs in order:")
-	for _, ip := range a {
-		log.Println(ip)
+	notes := interfaceNotes()
+	fmt.Fprintln(os.Stderr, "Available network interfaces:")
+	for idx, iface := range interfaces {
+		line := fmt.Sprintf("[%d] %s (%s)", idx, iface.Name, iface.HardwareAddr.String())
+		if note := notes[iface.Name]; note != "" {
+			line += " " + note
+		}
+		fmt.Fprintln(os.Stderr, line)
 	}
-}
 
-// Ping function remains unchanged
-func ping(c *icmp.PacketConn, targetIP string, seq int) error {
-	wm := icmp.Message{
-		Type: ipv4.ICMPTypeEcho, Code: 0,
-		Body: &icmp.Echo{
-			ID:   (os.Getpid() & 0xffff) + seq,
-			Seq:  seq,
-			Data: []byte("T"),
-		},
+	// Ask user to select an interface
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Fprint(os.Stderr, "Select the interface number you want to scan (or press Enter for custom IP range): ")
+	input, _ := reader.ReadString('\n')
+	input = strings.TrimSpace(input)
+
+	if input == "" {
+		// Custom IP range
+		fmt.Fprint(os.Stderr, "Enter custom IP range or CIDR (e.g., 192.168.1.1-192.168.1.254 or 192.168.1.0/24): ")
+		ipRange, _ := reader.ReadString('\n')
+		return strings.TrimSpace(ipRange)
+	}
+
+	// Scan IPs on the selected interface's subnet
+	interfaceIndex, err := strconv.Atoi(input)
+	if err != nil || interfaceIndex < 0 || interfaceIndex >= len(interfaces) {
+		log.Fatalf("Invalid interface number %q", input)
 	}
-	wb, err := wm.Marshal(nil)
+	return interfaceRange(&interfaces[interfaceIndex])
+}
+
+// interfaceRange returns the range covering the first IPv4 subnet on iface.
+func interfaceRange(iface *net.Interface) string {
+	addrs, err := iface.Addrs()
 	if err != nil {
-		return err
+		log.Fatalf("Error getting addresses: %s", err)
+	}
+
+	// Look for the first valid IPv4 address and parse it
+	for _, addr := range addrs {
+		ip, ipNet, err := net.ParseCIDR(addr.String())
+		if err == nil && ip.To4() != nil {
+			ipRange := getIPRange(ipNet)
+			fmt.Fprintf(os.Stderr, "Scanning range: %s\n", redactText(ipRange))
+			return ipRange
+		}
 	}
 
-	if _, err := c.WriteTo(wb, &net.IPAddr{IP: net.ParseIP(targetIP)}); err != nil {
-		return err
+	log.Fatalf("No valid IPv4 address found for interface %s", iface.Name)
+	return ""
+}
+
+// probeAddr is a destination reused across one worker's probes, so the
+// send path doesn't build a net.Addr per target.
+type probeAddr struct {
+	b   [4]byte
+	ip  net.IPAddr
+	udp net.UDPAddr
+}
+
+// set points a at ip and returns it in the form the ICMP socket takes.
+func (a *probeAddr) set(ip uint32) net.Addr {
+	binary.BigEndian.PutUint32(a.b[:], ip)
+	if unprivilegedICMP {
+		a.udp.IP = a.b[:]
+		return &a.udp
 	}
+	a.ip.IP = a.b[:]
+	return &a.ip
+}
 
-	rb := make([]byte, 1500)
-	c.SetReadDeadline(time.Now().Add(5 * time.Second)) // Set a read timeout of 5 seconds
+// packetWriter is the part of the ICMP socket that sendICMP writes to.
+type packetWriter interface {
+	WriteTo(b []byte, dst net.Addr) (int, error)
+}
 
-	n, peer, err := c.ReadFrom(rb)
-	if err != nil {
-		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-			// log.Printf("Timeout waiting for response from %s", targetIP)
-		} else {
+// sendICMP sends one echo request, or a timestamp request, to dst.
+// Packet buffers come from packetPool and dst from the caller's
+// probeAddr, so the path doesn't allocate; the net package's conversion
+// of dst to a socket address costs one allocation inside WriteTo.
+func sendICMP(c packetWriter, dst net.Addr, seq int, timestamp bool) error {
+	wb := getPacket()
+	defer putPacket(wb)
+	// Send times are wall clock, like the read deadlines they're
+	// measured against
+	now := time.Now()
+	pkt := marshalEcho(*wb, idBase+seq, seq, now.UnixNano())
+	if timestamp {
+		pkt = marshalTimestamp(*wb, idBase+seq, seq, msSinceMidnight(now))
+	}
+
+	for attempt := 0; ; attempt++ {
+		scanGate.wait()
+		sendLimiter.acquire()
+		engineStats.inFlight.Add(1)
+		_, err := c.WriteTo(pkt, dst)
+		engineStats.inFlight.Add(-1)
+		sendLimiter.release()
+		if err == nil {
+			engineStats.sent.Add(1)
+			return nil
+		}
+		if !isResourceError(err) || attempt == 5 {
+			engineStats.sendErrors.Add(1)
 			return err
 		}
-		return nil
+		sendLimiter.reduce(err)
+		backoff(attempt)
 	}
+}
 
-	rm, err := icmp.ParseMessage(ipv4.ICMPTypeEchoReply.Protocol(), rb[:n])
-	if err != nil {
-		return err
+// receiveICMP records every echo or timestamp reply from targets until
+// done is closed.
+func receiveICMP(c *icmp.PacketConn, targets targetSet, done <-chan struct{}) {
+	// Read through the ipv4 layer to get the reply's TTL; where the OS
+	// can't report it (Windows), ttl stays 0
+	r := newReplyReader(c)
+	reply := func(peer net.Addr, replyTTL int, pkt []byte) {
+		ip := peerIP(peer)
+		if !targets.contains(ipToInt(ip)) {
+			return // e.g. replies to another program's pings
+		}
+		engineStats.replies.Add(1)
+		var ttl int
+		var rtt time.Duration
+		if isEchoReply(pkt) || isTimestampReply(pkt) {
+			ttl = replyTTL
+			if sent, ok := echoSent(pkt); ok && isEchoReply(pkt) {
+				rtt = time.Since(time.Unix(0, sent))
+			} else if isTimestampReply(pkt) {
+				rtt = timestampRTT(pkt, time.Now())
+			}
+		}
+		if sessionRecorder != nil {
+			sessionRecorder.write(ip, ttl, rtt, pkt)
+		}
+		// TTL and RTT go in before the host is added, so a streamed
+		// result carries them
+		if ttl > 0 {
+			recordTTL(ip, ttl)
+		}
+		if rtt > 0 {
+			recordRTT(ip, rtt)
+		}
+		handleReply(ip, pkt)
+	}
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		c.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		if err := r.read(reply); err != nil {
+			if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+				scanError("Error reading ICMP reply: %s", err)
+			}
+		}
 	}
+}
 
-	switch rm.Type {
-	case ipv4.ICMPTypeEchoReply:
-		// if echoReply, ok := rm.Body.(*icmp.Echo); ok {
-		// log.Printf("Received valid response from %v, ID: %v", peer, echoReply.ID)
-		add(peer.String())
-		// }
-	default:
+// handleReply processes one ICMP message received from peer.
+func handleReply(peer string, pkt []byte) {
+	switch {
+	case isEchoReply(pkt):
+		add(peer, "icmp")
+	case isTimestampReply(pkt):
+		add(peer, "timestamp")
 	}
+}
 
-	return nil
+// peerIP returns the address of an ICMP peer without the zero port that
+// datagram ICMP sockets attach.
+func peerIP(addr net.Addr) string {
+	if u, ok := addr.(*net.UDPAddr); ok {
+		return u.IP.String()
+	}
+	return addr.String()
+}
+
+// pastDeadline reports whether the --deadline for the scan has passed.
+func pastDeadline() bool {
+	return !scanDeadline.IsZero() && scanClock.Now().After(scanDeadline)
 }
 
 // ipToInt converts an IP address string to an integer.
-func ipToInt(ipStr string) int {
+func ipToInt(ipStr string) uint32 {
 	ip := net.ParseIP(ipStr).To4()
 	if ip == nil {
 		return 0
 	}
-	return int(ip[0])<<24 + int(ip[1])<<16 + int(ip[2])<<8 + int(ip[3])
+	return binary.BigEndian.Uint32(ip)
 }
 
 // intToIP converts an integer back to an IP address.
-func intToIP(ipInt int) string {
+func intToIP(ipInt uint32) string {
 	return fmt.Sprintf("%d.%d.%d.%d", (ipInt>>24)&0xFF, (ipInt>>16)&0xFF, (ipInt>>8)&0xFF, ipInt&0xFF)
 }
 
-// parseIPRange takes a string like "192.168.1.1-192.168.1.254" and returns the start and end IPs.
-func parseIPRange(rangeStr string) (startIP, endIP string) {
-	ips := strings.Split(rangeStr, "-")
-	if len(ips) == 2 {
-		return ips[0], ips[1]
+// maxFirstTargets bounds how many addresses --first may put ahead of the
+// rest, since each one is held in memory.
+const maxFirstTargets = 1 << 16
+
+// parseFirst parses the --first list, keeping only IPs among the targets,
+// in the order given. Entries are anything --range accepts, or "gateway"
+// for the default gateways.
+func parseFirst(list string, targets targetSet) ([]uint32, error) {
+	var ips []uint32
+	seen := make(map[uint32]bool)
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		expr := s
+		if s == "gateway" {
+			gws := defaultGateways()
+			if len(gws) == 0 {
+				log.Printf("Ignoring priority target gateway: no default gateway found")
+				continue
+			}
+			expr = strings.Join(gws, ",")
+		}
+		set, err := parseTargets([]string{expr}, nil)
+		if err != nil {
+			return nil, err
+		}
+		set = set.subtract(set.subtract(targets))
+		if len(set) == 0 {
+			log.Printf("Ignoring priority target %s: not in scan targets", displayHost(s))
+			continue
+		}
+		if int64(len(ips))+set.count() > maxFirstTargets {
+			return nil, fmt.Errorf("more than %d priority targets", maxFirstTargets)
+		}
+		for _, r := range set {
+			for ip := r.start; ; ip++ {
+				if !seen[ip] {
+					seen[ip] = true
+					ips = append(ips, ip)
+				}
+				if ip == r.end {
+					break
+				}
+			}
+		}
 	}
-	return "0.0.0.0", "0.0.0.0" // Invalid range
+	return ips, nil
 }
 
 // getIPRange extracts the IP range from a CIDR address.
@@ -211,3 +743,14 @@ func lastIPInRange(ipNet *net.IPNet) net.IP {
 	}
 	return last
 }
+
+// flagSet reports whether the named flag was given on the command line.
+func flagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
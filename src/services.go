@@ -0,0 +1,153 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed services.txt
+var servicesData string
+
+//go:embed topports.txt
+var topPortsData string
+
+type service struct {
+	name  string
+	port  int
+	proto string
+}
+
+var services = parseServices(servicesData)
+
+// topPorts maps a protocol to its ports, most commonly open first.
+var topPorts = parseTopPorts(topPortsData)
+
+func parseServices(data string) []service {
+	var svcs []service
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		port, proto, ok := strings.Cut(fields[1], "/")
+		n, err := strconv.Atoi(port)
+		if ok && err == nil {
+			svcs = append(svcs, service{fields[0], n, proto})
+		}
+	}
+	return svcs
+}
+
+func parseTopPorts(data string) map[string][]int {
+	top := make(map[string][]int)
+	for _, line := range strings.Split(data, "\n") {
+		proto, list, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if !ok || strings.HasPrefix(proto, "#") {
+			continue
+		}
+		for _, p := range strings.Split(list, ",") {
+			if n, err := strconv.Atoi(p); err == nil {
+				top[proto] = append(top[proto], n)
+			}
+		}
+	}
+	return top
+}
+
+// servicePort looks up a service name for proto, falling back to the same
+// name under another protocol.
+func servicePort(name, proto string) (int, bool) {
+	fallback := 0
+	for _, s := range services {
+		if s.name != name {
+			continue
+		}
+		if s.proto == proto {
+			return s.port, true
+		}
+		if fallback == 0 {
+			fallback = s.port
+		}
+	}
+	return fallback, fallback != 0
+}
+
+// serviceName returns the well-known name of port/proto, or "".
+func serviceName(port int, proto string) string {
+	for _, s := range services {
+		if s.port == port && s.proto == proto {
+			return s.name
+		}
+	}
+	return ""
+}
+
+// parsePortSpec expands a port specification such as
+// "22,80,443,8000-8100" or "ssh,http,https" into sorted, unique ports.
+func parsePortSpec(spec, proto string) ([]int, error) {
+	seen := make(map[int]bool)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		lo, hi, err := parsePortItem(item, proto)
+		if err != nil {
+			return nil, err
+		}
+		for p := lo; p <= hi; p++ {
+			seen[p] = true
+		}
+	}
+	ports := make([]int, 0, len(seen))
+	for p := range seen {
+		ports = append(ports, p)
+	}
+	sort.Ints(ports)
+	return ports, nil
+}
+
+// parsePortItem parses one port, port range or service name.
+func parsePortItem(item, proto string) (lo, hi int, err error) {
+	if from, to, ok := strings.Cut(item, "-"); ok {
+		lo, err1 := strconv.Atoi(from)
+		hi, err2 := strconv.Atoi(to)
+		if err1 == nil && err2 == nil {
+			if lo < 1 || hi > 65535 || lo > hi {
+				return 0, 0, fmt.Errorf("invalid port range %q", item)
+			}
+			return lo, hi, nil
+		}
+	}
+	if n, err := strconv.Atoi(item); err == nil {
+		if n < 1 || n > 65535 {
+			return 0, 0, fmt.Errorf("invalid port %q", item)
+		}
+		return n, n, nil
+	}
+	if n, ok := servicePort(strings.ToLower(item), proto); ok {
+		return n, n, nil
+	}
+	return 0, 0, fmt.Errorf("unknown port or service %q", item)
+}
+
+// topPortList returns the n most commonly open ports for proto.
+func topPortList(n int, proto string) ([]int, error) {
+	top := topPorts[proto]
+	if n < 1 || n > len(top) {
+		return nil, fmt.Errorf("--top-ports must be between 1 and %d for %s", len(top), proto)
+	}
+	return top[:n], nil
+}
+
+// joinPorts renders ports as a comma-separated spec.
+func joinPorts(ports []int) string {
+	s := make([]string, len(ports))
+	for i, p := range ports {
+		s[i] = strconv.Itoa(p)
+	}
+	return strings.Join(s, ",")
+}
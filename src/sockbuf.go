@@ -0,0 +1,46 @@
+package main
+
+import "golang.org/x/net/icmp"
+
+// Bounds for the automatic socket buffer size.
+const (
+	minSockBuf = 256 << 10
+	maxSockBuf = 8 << 20
+)
+
+// autoSockBuf picks a buffer size for a scan of n targets: room for roughly
+// one reply per target, within sane bounds.
+func autoSockBuf(n int64) int {
+	size := n * 128
+	if size < minSockBuf {
+		return minSockBuf
+	}
+	if size > maxSockBuf {
+		return maxSockBuf
+	}
+	return int(size)
+}
+
+// setSockBufs applies --sndbuf/--rcvbuf to the ICMP socket, sizing any that
+// are zero from the number of targets. The OS may clamp the values.
+func setSockBufs(c *icmp.PacketConn, targets int64, sndbuf, rcvbuf int) {
+	conn, ok := c.IPv4PacketConn().PacketConn.(interface {
+		SetReadBuffer(int) error
+		SetWriteBuffer(int) error
+	})
+	if !ok {
+		return
+	}
+	if sndbuf == 0 {
+		sndbuf = autoSockBuf(targets)
+	}
+	if rcvbuf == 0 {
+		rcvbuf = autoSockBuf(targets)
+	}
+	if err := conn.SetWriteBuffer(sndbuf); err != nil {
+		scanWarning("Error setting send buffer to %d: %s", sndbuf, err)
+	}
+	if err := conn.SetReadBuffer(rcvbuf); err != nil {
+		scanWarning("Error setting receive buffer to %d: %s", rcvbuf, err)
+	}
+}
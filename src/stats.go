@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// engineStats counts what the probe engine is doing, so --stats can show
+// why a scan is slow: too few probes in flight, sends failing, or probes
+// timing out.
+var engineStats struct {
+	sent       atomic.Int64 // probes handed to the network
+	sendErrors atomic.Int64 // probes the OS refused to send
+	replies    atomic.Int64 // replies from targets
+	timeouts   atomic.Int64 // connect and UDP probes that got no answer
+	inFlight   atomic.Int64 // probes being sent or awaiting their own answer
+	queued     atomic.Int64 // targets the current pass hasn't reached yet
+}
+
+// statsSnapshot is engineStats at one moment.
+type statsSnapshot struct {
+	sent, sendErrors, replies, timeouts, inFlight, queued int64
+}
+
+func takeStats() statsSnapshot {
+	return statsSnapshot{
+		sent:       engineStats.sent.Load(),
+		sendErrors: engineStats.sendErrors.Load(),
+		replies:    engineStats.replies.Load(),
+		timeouts:   engineStats.timeouts.Load(),
+		inFlight:   engineStats.inFlight.Load(),
+		queued:     engineStats.queued.Load(),
+	}
+}
+
+// statsLine describes cur, with rates over the elapsed time since prev,
+// and the send limit the limiter has settled on.
+func statsLine(prev, cur statsSnapshot, elapsed time.Duration) string {
+	rate := func(a, b int64) int64 {
+		if elapsed <= 0 {
+			return 0
+		}
+		return int64(float64(b-a) / elapsed.Seconds())
+	}
+	return fmt.Sprintf("Stats: %d sent (%d/s), %d send errors, %d replies (%d/s), %d timeouts (%d/s), %d in flight (limit %d), %d queued",
+		cur.sent, rate(prev.sent, cur.sent), cur.sendErrors, cur.replies, rate(prev.replies, cur.replies),
+		cur.timeouts, rate(prev.timeouts, cur.timeouts), cur.inFlight, sendLimiter.current(), cur.queued)
+}
+
+// reportStats logs a stats line every interval until done is closed.
+func reportStats(interval time.Duration, done <-chan struct{}) {
+	prev, last := takeStats(), time.Now()
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-t.C:
+			cur := takeStats()
+			log.Print(statsLine(prev, cur, now.Sub(last)))
+			prev, last = cur, now
+		}
+	}
+}
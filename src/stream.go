@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// --output ndjson writes one JSON object per line. A "host" event goes
+// out the moment a host is found, with what discovery knows about it; a
+// "result" event per host follows once the scan is done, with reverse
+// DNS, ports and everything else the other formats report. Filter on
+// event to take either, e.g. jq 'select(.event == "host")'.
+
+// ndjsonHost is one line of --output ndjson.
+type ndjsonHost struct {
+	Event    string       `json:"event"`
+	Time     string       `json:"time,omitempty"`
+	IP       string       `json:"ip"`
+	Method   string       `json:"method,omitempty"`
+	Name     string       `json:"name,omitempty"`
+	Hostname string       `json:"hostname,omitempty"`
+	MAC      string       `json:"mac,omitempty"`
+	Vendor   string       `json:"vendor,omitempty"`
+	Gateway  bool         `json:"gateway,omitempty"`
+	AdminURL string       `json:"admin_url,omitempty"`
+	TTL      int          `json:"ttl,omitempty"`
+	OS       string       `json:"os_guess,omitempty"`
+	RTT      float64      `json:"rtt_ms,omitempty"`
+	Ports    []ndjsonPort `json:"ports,omitempty"`
+}
+
+// ndjsonPort is a port of a "result" event.
+type ndjsonPort struct {
+	Port    int         `json:"port"`
+	Proto   string      `json:"proto"`
+	State   string      `json:"state"`
+	Service string      `json:"service,omitempty"`
+	Version string      `json:"version,omitempty"`
+	Banner  string      `json:"banner,omitempty"`
+	Cert    *ndjsonCert `json:"cert,omitempty"`
+	HTTP    *ndjsonHTTP `json:"http,omitempty"`
+}
+
+type ndjsonCert struct {
+	Subject  string   `json:"subject"`
+	Issuer   string   `json:"issuer"`
+	SANs     []string `json:"sans,omitempty"`
+	NotAfter string   `json:"not_after"`
+}
+
+type ndjsonHTTP struct {
+	Status  int    `json:"status"`
+	Server  string `json:"server,omitempty"`
+	Title   string `json:"title,omitempty"`
+	Favicon string `json:"favicon_hash,omitempty"`
+}
+
+// streamOut serializes NDJSON lines on stdout, which discovery goroutines
+// write to concurrently.
+var streamOut struct {
+	sync.Mutex
+	w io.Writer
+}
+
+func init() { streamOut.w = os.Stdout }
+
+// streamHost writes the "host" event for a newly found ip.
+func streamHost(ip string) {
+	h := ndjsonHost{
+		Event:  "host",
+		Time:   scanClock.Now().UTC().Format(time.RFC3339Nano),
+		IP:     display(ip),
+		Method: foundBy(ip),
+		TTL:    scannedTTL(ip),
+		RTT:    rttMillis(scannedRTT(ip)),
+	}
+	if h.TTL > 0 {
+		h.OS, _ = guessOS(h.TTL)
+	}
+	if mac := scannedMAC(ip); mac != nil {
+		h.MAC, h.Vendor = displayMAC(mac), macVendor(mac)
+	}
+	streamOut.Lock()
+	defer streamOut.Unlock()
+	json.NewEncoder(streamOut.w).Encode(h)
+}
+
+// writeNDJSON writes a "result" event for each host.
+func writeNDJSON(w io.Writer, hosts []hostResult) error {
+	streamOut.Lock()
+	defer streamOut.Unlock()
+	enc := json.NewEncoder(w)
+	for _, h := range hosts {
+		line := ndjsonHost{
+			Event: "result", IP: h.IP, Method: h.Method, Name: h.Name, Hostname: h.Hostname,
+			MAC: h.MAC, Vendor: h.Vendor, Gateway: h.Gateway, AdminURL: h.AdminURL, TTL: h.TTL, OS: h.OS, RTT: rttMillis(h.RTT),
+		}
+		for _, p := range h.Ports {
+			np := ndjsonPort{Port: p.Port, Proto: p.Proto, State: p.State, Service: p.Service, Version: p.Version}
+			if !*redact {
+				np.Banner = p.Banner
+			}
+			if c := p.Cert; c != nil {
+				np.Cert = &ndjsonCert{Subject: displayName(c.Subject), Issuer: displayName(c.Issuer), NotAfter: c.NotAfter.UTC().Format(time.RFC3339)}
+				for _, san := range c.SANs {
+					np.Cert.SANs = append(np.Cert.SANs, displayName(san))
+				}
+			}
+			if web := p.HTTP; web != nil {
+				np.HTTP = &ndjsonHTTP{Status: web.Status, Server: web.Server, Favicon: web.Favicon}
+				if !*redact {
+					np.HTTP.Title = web.Title
+				}
+			}
+			line.Ports = append(line.Ports, np)
+		}
+		if err := enc.Encode(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rttMillis converts a round-trip time to milliseconds, rounded to the
+// microsecond.
+func rttMillis(d time.Duration) float64 {
+	return float64(d.Round(time.Microsecond)) / float64(time.Millisecond)
+}
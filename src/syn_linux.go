@@ -0,0 +1,128 @@
+//go:build !noports
+
+package main
+
+import (
+	"encoding/binary"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+func init() { registerFeature("tcp-syn") }
+
+// scanSYN runs a half-open scan: it sends a bare SYN to every port and
+// classifies each by the reply it sniffs. SYN/ACK is open, RST is closed,
+// and no reply within the timeout is filtered. The kernel answers each
+// SYN/ACK with an RST, so no connection is ever completed.
+func (ps *portScan) scanSYN(hosts []string) error {
+	conn, err := net.ListenPacket("ip4:tcp", "0.0.0.0")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	srcPort := 40000 + probeIntn(20000)
+	type key struct {
+		ip   string
+		port int
+	}
+	var mu sync.Mutex
+	states := make(map[key]string)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		buf := make([]byte, 1500)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+			n, peer, err := conn.ReadFrom(buf)
+			if err != nil || n < 20 {
+				continue
+			}
+			seg := buf[:n]
+			if int(binary.BigEndian.Uint16(seg[2:])) != srcPort {
+				continue
+			}
+			state := ""
+			switch flags := seg[13]; {
+			case flags&0x12 == 0x12: // SYN+ACK
+				state = portOpen
+			case flags&0x04 != 0: // RST
+				state = portClosed
+			default:
+				continue
+			}
+			k := key{peer.String(), int(binary.BigEndian.Uint16(seg[0:]))}
+			mu.Lock()
+			if _, seen := states[k]; !seen {
+				states[k] = state
+			}
+			mu.Unlock()
+		}
+	}()
+
+	sources := make(map[string]net.IP)
+	skipped := 0
+	for _, ip := range hosts {
+		dst := net.ParseIP(ip).To4()
+		src, ok := sources[ip]
+		if !ok {
+			src = routeSource(dst)
+			sources[ip] = src
+		}
+		if src == nil {
+			scanError("No route to %s, skipping", ip)
+			continue
+		}
+		for _, port := range ps.ports {
+			scanGate.wait()
+			if pastDeadline() {
+				skipped++
+				continue
+			}
+			seg := synSegment(src, dst, srcPort, port)
+			for attempt := 0; ; attempt++ {
+				_, err := conn.WriteTo(seg, &net.IPAddr{IP: dst})
+				if err == nil {
+					break
+				}
+				if !isResourceError(err) || attempt == 5 {
+					scanError("Error sending SYN to %s:%d: %s", ip, port, err)
+					break
+				}
+				backoff(attempt)
+			}
+		}
+	}
+
+	// Give the last SYNs their full timeout to be answered
+	settle(ps.timeout)
+	close(done)
+	wg.Wait()
+
+	for _, ip := range hosts {
+		for _, port := range ps.ports {
+			state, ok := states[key{ip, port}]
+			if !ok {
+				state = portFiltered
+			}
+			storePort(ip, portResult{Port: port, Proto: "tcp", State: state})
+			if state != portFiltered {
+				add(ip, "tcp")
+			}
+		}
+	}
+	if skipped > 0 {
+		log.Printf("Deadline reached: %d port probes skipped", skipped)
+	}
+	return nil
+}
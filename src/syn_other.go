@@ -0,0 +1,11 @@
+//go:build !linux && !noports
+
+package main
+
+import "errors"
+
+// scanSYN needs raw TCP sockets that can both send SYNs and sniff the
+// replies, which only Linux provides.
+func (ps *portScan) scanSYN(hosts []string) error {
+	return errors.New("SYN scanning is only supported on Linux")
+}
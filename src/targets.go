@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// parseTarget parses a target expression into inclusive ranges of IPs.
+// It accepts a single address (10.0.0.5), a dash range
+// (192.168.1.1-192.168.1.254), a CIDR block (10.0.0.0/22) or nmap-style
+// octet ranges and wildcards (192.168.1-3.*, 10.0.0.1-254).
+func parseTarget(s string) ([]addrRange, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case strings.Contains(s, "/"):
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", s, err)
+		}
+		if !prefix.Addr().Is4() {
+			return nil, fmt.Errorf("invalid CIDR %q: only IPv4 is supported", s)
+		}
+		prefix = prefix.Masked()
+		start := addrToInt(prefix.Addr())
+		end := start | ^uint32(0)>>prefix.Bits()
+		return []addrRange{{start, end}}, nil
+	case strings.Count(s, ".") == 3 && strings.ContainsAny(s, "*-"):
+		return parseOctets(s)
+	case strings.Contains(s, "-"):
+		from, to, _ := strings.Cut(s, "-")
+		start, err := parseAddr(from)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseAddr(to)
+		if err != nil {
+			return nil, err
+		}
+		if start > end {
+			return nil, fmt.Errorf("invalid range %q: start is after end", s)
+		}
+		return []addrRange{{start, end}}, nil
+	default:
+		ip, err := parseAddr(s)
+		if err != nil {
+			return nil, err
+		}
+		return []addrRange{{ip, ip}}, nil
+	}
+}
+
+// maxOctetRanges bounds how many disjoint ranges one octet pattern may
+// expand to, so a pattern like 1-254.1-254.1-254.1 can't exhaust memory.
+const maxOctetRanges = 1 << 16
+
+// parseOctets expands a pattern where each octet is a number, a range
+// (1-3) or a wildcard (*), e.g. 192.168.1-3.* or 10.0.0.1-254.
+func parseOctets(s string) ([]addrRange, error) {
+	var lo, hi [4]int
+	for i, part := range strings.Split(s, ".") {
+		var err error
+		if lo[i], hi[i], err = parseOctet(part); err != nil {
+			return nil, fmt.Errorf("invalid target %q: %w", s, err)
+		}
+	}
+
+	// Trailing octets that span 0-255 fold into one contiguous range per
+	// combination of the octets before them.
+	k := 3
+	for k > 0 && lo[k] == 0 && hi[k] == 255 {
+		k--
+	}
+	span := uint64(1) << (8 * (3 - k))
+	combos := 1
+	for i := 0; i <= k; i++ {
+		combos *= hi[i] - lo[i] + 1
+	}
+	if combos > maxOctetRanges {
+		return nil, fmt.Errorf("invalid target %q: expands to %d separate ranges (at most %d)", s, combos, maxOctetRanges)
+	}
+
+	var ranges []addrRange
+	var walk func(i int, base uint64)
+	walk = func(i int, base uint64) {
+		if i == k {
+			start := (base<<8 | uint64(lo[k])) * span
+			end := (base<<8|uint64(hi[k]))*span + span - 1
+			ranges = append(ranges, addrRange{uint32(start), uint32(end)})
+			return
+		}
+		for o := lo[i]; o <= hi[i]; o++ {
+			walk(i+1, base<<8|uint64(o))
+		}
+	}
+	walk(0, 0)
+	return ranges, nil
+}
+
+// parseOctet parses one octet of a pattern into its inclusive bounds.
+func parseOctet(part string) (lo, hi int, err error) {
+	if part == "*" {
+		return 0, 255, nil
+	}
+	from, to, isRange := strings.Cut(part, "-")
+	if lo, err = strconv.Atoi(from); err != nil || lo < 0 || lo > 255 {
+		return 0, 0, fmt.Errorf("bad octet %q", part)
+	}
+	if !isRange {
+		return lo, lo, nil
+	}
+	if hi, err = strconv.Atoi(to); err != nil || hi < lo || hi > 255 {
+		return 0, 0, fmt.Errorf("bad octet range %q", part)
+	}
+	return lo, hi, nil
+}
+
+// parseAddr parses a single IPv4 address.
+func parseAddr(s string) (uint32, error) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid IP address %q", s)
+	}
+	if !addr.Is4() {
+		return 0, fmt.Errorf("invalid IP address %q: only IPv4 is supported", s)
+	}
+	return addrToInt(addr), nil
+}
+
+// addrToInt converts an IPv4 netip.Addr to an integer.
+func addrToInt(addr netip.Addr) uint32 {
+	b := addr.As4()
+	return binary.BigEndian.Uint32(b[:])
+}
+
+// addrRange is an inclusive range of IPv4 addresses, as integers. They
+// are uint32 so the whole address space fits on 32-bit platforms too;
+// code walking a range can't rely on end+1 being larger than end.
+type addrRange struct {
+	start, end uint32
+}
+
+// targetSet is a sorted list of disjoint, non-adjacent ranges.
+type targetSet []addrRange
+
+// parseTargets parses target expressions, each of which may hold several
+// comma-separated targets, and merges them into one deduplicated set.
+// Hostnames are resolved; when names is non-nil, each resolved address is
+// mapped back to the name it was given as.
+func parseTargets(exprs []string, names map[uint32][]string) (targetSet, error) {
+	var ranges []addrRange
+	for _, expr := range exprs {
+		for _, s := range strings.Split(expr, ",") {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+			parsed, err := parseTarget(s)
+			if err == nil {
+				ranges = append(ranges, parsed...)
+				continue
+			}
+			if !isHostname(s) {
+				return nil, err
+			}
+			ips, err := resolveTarget(s)
+			if err != nil {
+				return nil, err
+			}
+			for _, ip := range ips {
+				ranges = append(ranges, addrRange{ip, ip})
+				if names != nil {
+					names[ip] = append(names[ip], s)
+				}
+			}
+		}
+	}
+	return mergeRanges(ranges), nil
+}
+
+// isHostname reports whether s looks like a DNS name rather than a
+// malformed address: only letters, digits, dots and dashes, with at least
+// one letter.
+func isHostname(s string) bool {
+	letter := false
+	for _, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+			letter = true
+		case c >= '0' && c <= '9', c == '.', c == '-':
+		default:
+			return false
+		}
+	}
+	return letter
+}
+
+// resolveTarget looks up the IPv4 addresses of a hostname target.
+func resolveTarget(name string) ([]uint32, error) {
+	addrs, err := net.LookupIP(name)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", name, err)
+	}
+	var ips []uint32
+	for _, addr := range addrs {
+		if v4 := addr.To4(); v4 != nil {
+			ips = append(ips, binary.BigEndian.Uint32(v4))
+			log.Printf("Resolved %s to %s", displayName(name), display(v4.String()))
+		}
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("resolving %s: no IPv4 addresses (IPv6 is not scanned)", name)
+	}
+	return ips, nil
+}
+
+// mergeRanges sorts ranges and coalesces any that overlap or touch.
+func mergeRanges(ranges []addrRange) targetSet {
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].start < ranges[j].start })
+	var set targetSet
+	for _, r := range ranges {
+		if n := len(set); n > 0 && (set[n-1].end == math.MaxUint32 || r.start <= set[n-1].end+1) {
+			if r.end > set[n-1].end {
+				set[n-1].end = r.end
+			}
+			continue
+		}
+		set = append(set, r)
+	}
+	return set
+}
+
+// subtract returns the addresses of t that are not in ex.
+func (t targetSet) subtract(ex targetSet) targetSet {
+	var out targetSet
+	for _, r := range t {
+		start, covered := r.start, false
+		for _, e := range ex {
+			if e.end < start || e.start > r.end {
+				continue
+			}
+			if e.start > start {
+				out = append(out, addrRange{start, e.start - 1})
+			}
+			if e.end >= r.end {
+				covered = true
+				break
+			}
+			start = e.end + 1
+		}
+		if !covered {
+			out = append(out, addrRange{start, r.end})
+		}
+	}
+	return out
+}
+
+// forEachTarget calls fn for the IPs in first, then for every other IP in
+// the set in ascending order. The targets not yet reached are counted in
+// engineStats.queued.
+func forEachTarget(t targetSet, first []uint32, fn func(ip uint32)) {
+	engineStats.queued.Store(t.count())
+	defer engineStats.queued.Store(0)
+	isFirst := make(map[uint32]bool, len(first))
+	for _, ip := range first {
+		isFirst[ip] = true
+		engineStats.queued.Add(-1)
+		fn(ip)
+	}
+	for _, r := range t {
+		for ip := r.start; ; ip++ {
+			if !isFirst[ip] {
+				engineStats.queued.Add(-1)
+				fn(ip)
+			}
+			if ip == r.end {
+				break
+			}
+		}
+	}
+}
+
+// count returns the number of addresses in the set, which is 1<<32 for
+// 0.0.0.0/0.
+func (t targetSet) count() int64 {
+	var n int64
+	for _, r := range t {
+		n += int64(r.end-r.start) + 1
+	}
+	return n
+}
+
+// contains reports whether ip is in the set.
+func (t targetSet) contains(ip uint32) bool {
+	i := sort.Search(len(t), func(i int) bool { return t[i].end >= ip })
+	return i < len(t) && t[i].start <= ip
+}
+
+// String renders the set as comma-separated ranges.
+func (t targetSet) String() string {
+	parts := make([]string, len(t))
+	for i, r := range t {
+		if r.start == r.end {
+			parts[i] = intToIP(r.start)
+		} else {
+			parts[i] = intToIP(r.start) + "-" + intToIP(r.end)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// stringList is a flag.Value collecting every use of a repeatable flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// readTargetFile reads one target per line from path, or from stdin when
+// path is "-". Blank lines and anything after a '#' are ignored.
+func readTargetFile(path string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var targets []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		if line = strings.TrimSpace(line); line != "" {
+			targets = append(targets, line)
+		}
+	}
+	return targets, sc.Err()
+}
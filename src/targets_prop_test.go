@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+	"testing/quick"
+)
+
+// Property tests for the range math. A bug here silently drops or adds
+// hosts, so each property is checked over many random inputs.
+
+var quickConfig = &quick.Config{MaxCount: 2000}
+
+// randomRanges returns up to five ranges packed into a small window of
+// address space, so overlaps and adjacency are common. The window may
+// sit at either edge of the address space.
+func randomRanges(r *rand.Rand) []addrRange {
+	base := uint32(r.Int63n(1<<32 - 256))
+	switch r.Intn(4) {
+	case 0:
+		base = 0
+	case 1:
+		base = 1<<32 - 256
+	}
+	ranges := make([]addrRange, r.Intn(6))
+	for i := range ranges {
+		start := base + uint32(r.Intn(256))
+		end := start + uint32(r.Intn(int(min(40, base+256-start))))
+		ranges[i] = addrRange{start, end}
+	}
+	return ranges
+}
+
+func inRanges(ranges []addrRange, ip uint32) bool {
+	for _, r := range ranges {
+		if r.start <= ip && ip <= r.end {
+			return true
+		}
+	}
+	return false
+}
+
+// probePoints returns the addresses where range math goes wrong: every
+// boundary and its neighbours, wrapping around at the ends of the
+// address space.
+func probePoints(sets ...[]addrRange) []uint32 {
+	var pts []uint32
+	for _, set := range sets {
+		for _, r := range set {
+			pts = append(pts, r.start-1, r.start, r.start+1, r.end-1, r.end, r.end+1)
+		}
+	}
+	return pts
+}
+
+func TestPropCIDRBounds(t *testing.T) {
+	prop := func(ip uint32, bits uint8) bool {
+		bits %= 33
+		got, err := parseTarget(fmt.Sprintf("%s/%d", intToIP(ip), bits))
+		if err != nil || len(got) != 1 {
+			return false
+		}
+		size := int64(1) << (32 - bits)
+		r := got[0]
+		// inclusive bounds: aligned start, exactly 2^(32-bits) addresses,
+		// and the original address inside
+		return int64(r.start)%size == 0 && int64(r.end-r.start)+1 == size && r.start <= ip && ip <= r.end
+	}
+	if err := quick.Check(prop, quickConfig); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPropDashRangeRoundTrip(t *testing.T) {
+	prop := func(a, b uint32) bool {
+		lo, hi := min(a, b), max(a, b)
+		got, err := parseTarget(intToIP(lo) + "-" + intToIP(hi))
+		return err == nil && len(got) == 1 && got[0] == addrRange{lo, hi}
+	}
+	if err := quick.Check(prop, quickConfig); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPropMergeRanges(t *testing.T) {
+	prop := func(seed int64) bool {
+		ranges := randomRanges(rand.New(rand.NewSource(seed)))
+		input := append([]addrRange(nil), ranges...)
+		set := mergeRanges(ranges)
+		for i := 1; i < len(set); i++ {
+			if set[i-1].end == math.MaxUint32 || set[i].start <= set[i-1].end+1 { // overlapping or touching
+				return false
+			}
+		}
+		// same membership as the input at every boundary
+		for _, ip := range probePoints(input) {
+			if set.contains(ip) != inRanges(input, ip) {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(prop, quickConfig); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPropStringRoundTrip(t *testing.T) {
+	prop := func(seed int64) bool {
+		set := mergeRanges(randomRanges(rand.New(rand.NewSource(seed))))
+		if len(set) == 0 {
+			return true
+		}
+		again, err := parseTargets([]string{set.String()}, nil)
+		return err == nil && again.String() == set.String() && again.count() == set.count()
+	}
+	if err := quick.Check(prop, quickConfig); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPropSubtract(t *testing.T) {
+	prop := func(seed int64) bool {
+		r := rand.New(rand.NewSource(seed))
+		a, b := randomRanges(r), randomRanges(r)
+		setA, setB := mergeRanges(append([]addrRange(nil), a...)), mergeRanges(append([]addrRange(nil), b...))
+		diff := setA.subtract(setB)
+
+		// the result is itself a valid set
+		for i := 1; i < len(diff); i++ {
+			if diff[i].start <= diff[i-1].end {
+				return false
+			}
+		}
+		// x is in A-B exactly when it is in A and not in B
+		for _, ip := range probePoints(a, b) {
+			if diff.contains(ip) != (setA.contains(ip) && !setB.contains(ip)) {
+				return false
+			}
+		}
+		// nothing is lost: (A-B) and A∩B together account for all of A
+		var both int64
+		for _, rg := range setA {
+			for ip := rg.start; ; ip++ {
+				if setB.contains(ip) {
+					both++
+				}
+				if ip == rg.end {
+					break
+				}
+			}
+		}
+		return diff.count()+both == setA.count()
+	}
+	if err := quick.Check(prop, quickConfig); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPropForEachTargetVisitsOnce(t *testing.T) {
+	prop := func(seed int64) bool {
+		r := rand.New(rand.NewSource(seed))
+		set := mergeRanges(randomRanges(r))
+		var first []uint32
+		if len(set) > 0 && set.count() > 1 {
+			first = []uint32{set[len(set)-1].end, set[0].start}
+		}
+		seen := make(map[uint32]int)
+		forEachTarget(set, first, func(ip uint32) { seen[ip]++ })
+		if int64(len(seen)) != set.count() {
+			return false
+		}
+		for ip, n := range seen {
+			if n != 1 || !set.contains(ip) {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(prop, quickConfig); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import "testing"
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string // targetSet.String() of the result
+	}{
+		{"10.0.0.5", "10.0.0.5"},
+		{" 10.0.0.5 ", "10.0.0.5"},
+		{"192.168.1.1-192.168.1.254", "192.168.1.1-192.168.1.254"},
+		{"10.0.0.0/30", "10.0.0.0-10.0.0.3"},
+		{"10.0.0.7/30", "10.0.0.4-10.0.0.7"}, // host bits are masked off
+		{"10.0.0.1/32", "10.0.0.1"},
+		{"10.0.0.1-3", "10.0.0.1-10.0.0.3"},
+		{"10.0.1-2.5", "10.0.1.5,10.0.2.5"},
+		{"10.0.*.*", "10.0.0.0-10.0.255.255"},
+		{"10.1-2.*.*", "10.1.0.0-10.2.255.255"},
+		{"192.168.1.*", "192.168.1.0-192.168.1.255"},
+		{"0.0.0.0/0", "0.0.0.0-255.255.255.255"},
+		{"*.*.*.*", "0.0.0.0-255.255.255.255"},
+		{"200-255.*.*.*", "200.0.0.0-255.255.255.255"},
+		{"127.255.255.254-128.0.0.1", "127.255.255.254-128.0.0.1"},
+	}
+	for _, tt := range tests {
+		ranges, err := parseTarget(tt.in)
+		if err != nil {
+			t.Errorf("parseTarget(%q): %s", tt.in, err)
+			continue
+		}
+		if got := mergeRanges(ranges).String(); got != tt.want {
+			t.Errorf("parseTarget(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseTargetErrors(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"10.0.0",
+		"10.0.0.256",
+		"10.0.0.5-10.0.0.1",
+		"10.0.0.0/33",
+		"::1",
+		"fe80::/64",
+		"10.0.0.3-1",
+		"10.0.0.*-1",
+		"10.0.0.1-256",
+	} {
+		if r, err := parseTarget(in); err == nil {
+			t.Errorf("parseTarget(%q) = %v, want error", in, r)
+		}
+	}
+}
+
+func TestParseTargetsMerges(t *testing.T) {
+	set := mustTargets(t, "10.0.0.1-10.0.0.5,10.0.0.3", "10.0.0.6", "10.0.0.10/31")
+	if got, want := set.String(), "10.0.0.1-10.0.0.6,10.0.0.10-10.0.0.11"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if got := set.count(); got != 8 {
+		t.Errorf("count = %d, want 8", got)
+	}
+}
+
+func TestParseTargetsHostnameNames(t *testing.T) {
+	captureLog(t)
+	names := make(map[uint32][]string)
+	set, err := parseTargets([]string{"localhost"}, names)
+	if err != nil {
+		t.Skipf("localhost doesn't resolve here: %s", err)
+	}
+	if !set.contains(ipToInt("127.0.0.1")) {
+		t.Fatalf("localhost resolved to %s", set)
+	}
+	if got := names[ipToInt("127.0.0.1")]; !equalStrings(got, []string{"localhost"}) {
+		t.Errorf("names = %v", got)
+	}
+}
+
+func TestSubtract(t *testing.T) {
+	tests := []struct {
+		set, ex, want string
+	}{
+		{"10.0.0.0/24", "10.0.0.1", "10.0.0.0,10.0.0.2-10.0.0.255"},
+		{"10.0.0.0/24", "10.0.0.0/25", "10.0.0.128-10.0.0.255"},
+		{"10.0.0.1-10.0.0.9", "10.0.0.3-10.0.0.4,10.0.0.9", "10.0.0.1-10.0.0.2,10.0.0.5-10.0.0.8"},
+		{"10.0.0.1", "10.0.0.0/24", ""},
+		{"10.0.0.1-10.0.0.3", "192.168.0.0/16", "10.0.0.1-10.0.0.3"},
+	}
+	for _, tt := range tests {
+		got := mustTargets(t, tt.set).subtract(mustTargets(t, tt.ex)).String()
+		if got != tt.want {
+			t.Errorf("%s - %s = %q, want %q", tt.set, tt.ex, got, tt.want)
+		}
+	}
+}
+
+func TestForEachTargetFirst(t *testing.T) {
+	captureLog(t)
+	set := mustTargets(t, "10.0.0.1-10.0.0.4")
+	first, err := parseFirst("10.0.0.3,10.0.0.9", set) // .9 isn't a target
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	forEachTarget(set, first, func(ip uint32) { got = append(got, intToIP(ip)) })
+	want := []string{"10.0.0.3", "10.0.0.1", "10.0.0.2", "10.0.0.4"}
+	if !equalStrings(got, want) {
+		t.Errorf("order = %v, want %v", got, want)
+	}
+}
+
+func TestParseFirst(t *testing.T) {
+	captureLog(t)
+	set := mustTargets(t, "10.0.0.0/24")
+	for _, tt := range []struct {
+		list string
+		want []string
+	}{
+		{"10.0.0.9,10.0.0.3", []string{"10.0.0.9", "10.0.0.3"}},
+		{"10.0.0.254-10.0.1.2", []string{"10.0.0.254", "10.0.0.255"}},
+		{"10.0.0.4/31, 10.0.0.5", []string{"10.0.0.4", "10.0.0.5"}},
+		{"10.0.0-2.1", []string{"10.0.0.1"}},
+		{"192.168.0.0/16,", nil},
+	} {
+		first, err := parseFirst(tt.list, set)
+		var got []string
+		for _, ip := range first {
+			got = append(got, intToIP(ip))
+		}
+		if err != nil || !equalStrings(got, tt.want) {
+			t.Errorf("parseFirst(%q) = %v, %v, want %v", tt.list, got, err, tt.want)
+		}
+	}
+	for _, list := range []string{"10.0.0.300", "10.0.0.0/33", "10.0.0.5-10.0.0.1", "not_a_host"} {
+		if _, err := parseFirst(list, set); err == nil {
+			t.Errorf("parseFirst(%q) succeeded", list)
+		}
+	}
+	if _, err := parseFirst("0.0.0.0/0", mustTargets(t, "10.0.0.0/8")); err == nil {
+		t.Errorf("parseFirst kept a /8 of priority targets")
+	}
+}
+
+// The top of the address space, where end+1 wraps to zero.
+func TestTargetSetTopEdge(t *testing.T) {
+	all := mustTargets(t, "0.0.0.0/0")
+	if got := all.count(); got != 1<<32 {
+		t.Errorf("count of 0.0.0.0/0 = %d, want %d", got, int64(1)<<32)
+	}
+	if got := mustTargets(t, "255.255.255.255", "0.0.0.0/1", "128.0.0.0/1").String(); got != "0.0.0.0-255.255.255.255" {
+		t.Errorf("merge at the top = %s", got)
+	}
+	if got := all.subtract(mustTargets(t, "255.255.255.0/24")).String(); got != "0.0.0.0-255.255.254.255" {
+		t.Errorf("subtract at the top = %s", got)
+	}
+	var got []string
+	forEachTarget(mustTargets(t, "255.255.255.254-255.255.255.255"), nil, func(ip uint32) { got = append(got, intToIP(ip)) })
+	if want := []string{"255.255.255.254", "255.255.255.255"}; !equalStrings(got, want) {
+		t.Errorf("forEachTarget = %v, want %v", got, want)
+	}
+}
+
+func TestIPIntRoundTrip(t *testing.T) {
+	for _, ip := range []string{"0.0.0.0", "10.1.2.3", "255.255.255.255"} {
+		if got := intToIP(ipToInt(ip)); got != ip {
+			t.Errorf("intToIP(ipToInt(%s)) = %s", ip, got)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+func init() { registerFeature("tcp-ping") }
+
+// tcpPingTimeout is how long a TCP ping waits for a SYN/ACK or RST.
+const tcpPingTimeout = time.Second
+
+// scanTCPPing probes every target that hasn't answered yet on each of
+// ports. Any SYN/ACK or RST proves the host is up, which finds hosts that
+// drop echo requests, such as Windows machines with the default firewall.
+// SYNs go out over a raw socket where allowed, with full connects used
+// otherwise. It returns how many targets the deadline left unprobed.
+func scanTCPPing(targets targetSet, first []uint32, ports []int) int64 {
+	var syn *synPinger
+	if !unprivilegedICMP {
+		var err error
+		if syn, err = newSYNPinger(targets); err != nil {
+			scanWarning("Can't send raw SYNs (%s), TCP pinging with connects instead", err)
+		}
+	}
+
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	if syn == nil {
+		for i := 0; i < max(*concurrency, 1); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for ip := range jobs {
+					tcpPingConnect(ip, ports)
+				}
+			}()
+		}
+	}
+
+	var unprobed int64
+	forEachTarget(targets, first, func(ip uint32) {
+		target := intToIP(ip)
+		if found(target) {
+			return
+		}
+		scanGate.wait()
+		if pastDeadline() {
+			unprobed++
+			return
+		}
+		if syn != nil {
+			syn.send(target, ports)
+			return
+		}
+		jobs <- target
+	})
+	close(jobs)
+	wg.Wait()
+	if syn != nil {
+		syn.close()
+	}
+	return unprobed
+}
+
+// tcpPingConnect connects to ip on each port in turn until one is
+// accepted or refused, and records the host if either happens.
+func tcpPingConnect(ip string, ports []int) {
+	for _, port := range ports {
+		addr := net.JoinHostPort(ip, strconv.Itoa(port))
+		for attempt := 0; ; attempt++ {
+			sendLimiter.acquire()
+			start := time.Now()
+			engineStats.inFlight.Add(1)
+			conn, err := net.DialTimeout("tcp4", addr, tcpPingTimeout)
+			engineStats.inFlight.Add(-1)
+			sendLimiter.release()
+			engineStats.sent.Add(1)
+			if err == nil {
+				conn.Close()
+			}
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				engineStats.timeouts.Add(1)
+			} else if err == nil || isConnRefused(err) {
+				engineStats.replies.Add(1)
+			}
+			if err == nil || isConnRefused(err) {
+				recordRTT(ip, time.Since(start))
+				add(ip, "tcp")
+				return
+			}
+			if isResourceError(err) && attempt < 5 {
+				sendLimiter.reduce(err)
+				backoff(attempt)
+				continue
+			}
+			break
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+)
+
+// synPinger sends bare SYNs over a raw TCP socket and records every
+// target that answers with a SYN/ACK or RST. The kernel resets any
+// SYN/ACK itself, so no connection is completed.
+type synPinger struct {
+	conn    net.PacketConn
+	srcPort int
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// newSYNPinger opens the raw socket and starts sniffing replies from
+// targets. It needs root or CAP_NET_RAW.
+func newSYNPinger(targets targetSet) (*synPinger, error) {
+	conn, err := net.ListenPacket("ip4:tcp", "0.0.0.0")
+	if err != nil {
+		return nil, err
+	}
+	p := &synPinger{conn: conn, srcPort: 40000 + probeIntn(20000), done: make(chan struct{})}
+	p.wg.Add(1)
+	go p.receive(targets)
+	return p, nil
+}
+
+// receive records the sender of every SYN/ACK or RST to our source port.
+func (p *synPinger) receive(targets targetSet) {
+	defer p.wg.Done()
+	buf := make([]byte, 1500)
+	for {
+		select {
+		case <-p.done:
+			return
+		default:
+		}
+		p.conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		n, peer, err := p.conn.ReadFrom(buf)
+		if err != nil || n < 20 || int(binary.BigEndian.Uint16(buf[2:])) != p.srcPort {
+			continue
+		}
+		if flags := buf[13]; flags&0x12 != 0x12 && flags&0x04 == 0 { // neither SYN+ACK nor RST
+			continue
+		}
+		if ip := peer.String(); targets.contains(ipToInt(ip)) {
+			engineStats.replies.Add(1)
+			add(ip, "tcp")
+		}
+	}
+}
+
+// send sends a SYN to each of ports on ip.
+func (p *synPinger) send(ip string, ports []int) {
+	dst := net.ParseIP(ip).To4()
+	src := routeSource(dst)
+	if src == nil {
+		scanError("No route to %s, skipping", ip)
+		return
+	}
+	for _, port := range ports {
+		seg := synSegment(src, dst, p.srcPort, port)
+		for attempt := 0; ; attempt++ {
+			_, err := p.conn.WriteTo(seg, &net.IPAddr{IP: dst})
+			if err == nil {
+				engineStats.sent.Add(1)
+				break
+			}
+			if !isResourceError(err) || attempt == 5 {
+				engineStats.sendErrors.Add(1)
+				scanError("Error sending SYN to %s:%d: %s", ip, port, err)
+				break
+			}
+			backoff(attempt)
+		}
+	}
+}
+
+// close waits out the timeout for the last SYNs, then stops sniffing.
+func (p *synPinger) close() {
+	settle(tcpPingTimeout)
+	close(p.done)
+	p.wg.Wait()
+	p.conn.Close()
+}
+
+// routeSource returns the local address the kernel would use to reach dst.
+func routeSource(dst net.IP) net.IP {
+	c, err := net.DialUDP("udp4", nil, &net.UDPAddr{IP: dst, Port: 9})
+	if err != nil {
+		return nil
+	}
+	defer c.Close()
+	return c.LocalAddr().(*net.UDPAddr).IP.To4()
+}
+
+// synSegment builds a TCP SYN segment (with an MSS option) from src:srcPort
+// to dst:dstPort, checksummed over the IPv4 pseudo-header.
+func synSegment(src, dst net.IP, srcPort, dstPort int) []byte {
+	seg := make([]byte, 24)
+	binary.BigEndian.PutUint16(seg[0:], uint16(srcPort))
+	binary.BigEndian.PutUint16(seg[2:], uint16(dstPort))
+	binary.BigEndian.PutUint32(seg[4:], probeUint32()) // sequence number
+	seg[12] = 6 << 4                                   // data offset: 6 words
+	seg[13] = 0x02                                     // SYN
+	binary.BigEndian.PutUint16(seg[14:], 1024)         // window
+	copy(seg[20:], []byte{2, 4, 0x05, 0xb4})           // MSS 1460
+
+	pseudo := make([]byte, 12, 12+len(seg))
+	copy(pseudo[0:4], src)
+	copy(pseudo[4:8], dst)
+	pseudo[9] = 6 // protocol: TCP
+	binary.BigEndian.PutUint16(pseudo[10:], uint16(len(seg)))
+	binary.BigEndian.PutUint16(seg[16:], checksum(append(pseudo, seg...)))
+	return seg
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// synPinger is empty where raw SYN pings aren't supported.
+type synPinger struct{}
+
+// newSYNPinger reports that raw TCP sockets able to both send SYNs and
+// sniff the replies are only available on Linux.
+func newSYNPinger(targets targetSet) (*synPinger, error) {
+	return nil, errors.New("SYN pings are only supported on Linux")
+}
+
+func (p *synPinger) send(ip string, ports []int) {}
+
+func (p *synPinger) close() {}
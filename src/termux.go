@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// termuxMode is set when scli runs under Termux or elsewhere on Android,
+// where raw sockets need root and most of /proc is off limits.
+var termuxMode = isTermux()
+
+// isTermux reports whether this looks like an Android/Termux environment.
+func isTermux() bool {
+	if runtime.GOOS == "android" || os.Getenv("TERMUX_VERSION") != "" {
+		return true
+	}
+	if strings.Contains(os.Getenv("PREFIX"), "com.termux") {
+		return true
+	}
+	_, err := os.Stat("/system/build.prop")
+	return err == nil
+}
+
+// applyTermux switches to the discovery methods that work without root:
+// unprivileged ICMP, TCP connect scans and, unless --mdns was given, mDNS.
+// ARP needs raw sockets, so it is dropped from methods, with ICMP taking
+// its place when nothing else is left.
+func applyTermux(methods map[string]bool) {
+	log.Printf("Android/Termux detected: using unprivileged ICMP and connect scans")
+	if *icmpMode == "auto" {
+		unprivilegedICMP = true
+	}
+	if !flagSet(flag.CommandLine, "mdns") {
+		*mdnsScan = true
+	}
+	if methods["arp"] {
+		delete(methods, "arp")
+		if len(methods) == 0 {
+			log.Printf("ARP scanning needs raw sockets, using ICMP instead")
+			methods["icmp"] = true
+		} else {
+			log.Printf("ARP scanning needs raw sockets, skipping it")
+		}
+	}
+}
@@ -0,0 +1,66 @@
+//go:build !noports
+
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"strconv"
+	"time"
+)
+
+func init() { registerFeature("tls-certs") }
+
+// tlsPorts are the ports --tls handshakes with. Plain-text ports that
+// upgrade with STARTTLS are not included.
+var tlsPorts = map[int]bool{
+	443: true, 465: true, 636: true, 853: true, 990: true, 993: true, 995: true,
+	5061: true, 5986: true, 6443: true, 8443: true, 8883: true, 9443: true,
+}
+
+// inspectCerts performs a TLS handshake with every open TLS port found and
+// attaches the server's leaf certificate details to the port result.
+func (ps *portScan) inspectCerts() {
+	ps.eachOpenTCP(func(ip string, port int) func(*portResult) {
+		if !tlsPorts[port] {
+			return nil
+		}
+		cert, err := fetchCert(ip, port, ps.timeout)
+		if err != nil {
+			return nil
+		}
+		return func(p *portResult) { p.Cert = cert }
+	})
+}
+
+// fetchCert handshakes with ip:port and returns the leaf certificate. The
+// chain isn't verified: expired and self-signed certs are what we're
+// looking for. A hostname the target was given as is sent as SNI.
+func fetchCert(ip string, port int, timeout time.Duration) (*certInfo, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	cfg := &tls.Config{InsecureSkipVerify: true}
+	if names := targetNames[ipToInt(ip)]; len(names) > 0 {
+		cfg.ServerName = names[0]
+	}
+	conn, err := tls.DialWithDialer(dialer, "tcp4", net.JoinHostPort(ip, strconv.Itoa(port)), cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, nil
+	}
+	leaf := certs[0]
+	ci := &certInfo{
+		Subject:  leaf.Subject.String(),
+		Issuer:   leaf.Issuer.String(),
+		SANs:     append([]string(nil), leaf.DNSNames...),
+		NotAfter: leaf.NotAfter,
+	}
+	for _, addr := range leaf.IPAddresses {
+		ci.SANs = append(ci.SANs, addr.String())
+	}
+	return ci, nil
+}
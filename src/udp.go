@@ -0,0 +1,79 @@
+//go:build !noports
+
+package main
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"time"
+)
+
+func init() { registerFeature("udp") }
+
+// portOpenFiltered is the UDP state when nothing came back: the port may
+// be open and silent, or the probe or its reply was dropped.
+const portOpenFiltered = "open|filtered"
+
+// defaultUDPPorts are scanned by "scli ports --udp" when --ports isn't set.
+const defaultUDPPorts = "53,123,161,5353"
+
+// udpPayloads holds protocol-aware probes that well-known UDP services
+// answer. Other ports get an empty datagram.
+var udpPayloads = map[int][]byte{
+	53:   dnsQuery(".", 2),                             // NS for the root
+	123:  append([]byte{0x1b}, make([]byte, 47)...),    // NTPv3 client request
+	161:  snmpGetSysDescr,                              // SNMPv1 get sysDescr.0, community "public"
+	5353: dnsQuery("_services._dns-sd._udp.local", 12), // mDNS service enumeration (PTR)
+}
+
+// snmpGetSysDescr is an SNMPv1 GetRequest for 1.3.6.1.2.1.1.1.0.
+var snmpGetSysDescr = []byte{
+	0x30, 0x26, // SEQUENCE
+	0x02, 0x01, 0x00, // version: 1
+	0x04, 0x06, 'p', 'u', 'b', 'l', 'i', 'c', // community
+	0xa0, 0x19, // GetRequest PDU
+	0x02, 0x01, 0x01, // request-id
+	0x02, 0x01, 0x00, // error-status
+	0x02, 0x01, 0x00, // error-index
+	0x30, 0x0e, // varbind list
+	0x30, 0x0c, // varbind
+	0x06, 0x08, 0x2b, 0x06, 0x01, 0x02, 0x01, 0x01, 0x01, 0x00, // sysDescr.0
+	0x05, 0x00, // NULL
+}
+
+// probeUDP sends the port's payload to ip:port and classifies the result.
+// A reply means open. An ICMP port unreachable surfaces as a refused
+// read, which means closed. Silence after one retransmission is
+// open|filtered.
+func (ps *portScan) probeUDP(ip string, port int) string {
+	conn, err := net.Dial("udp4", net.JoinHostPort(ip, strconv.Itoa(port)))
+	if err != nil {
+		return portOpenFiltered
+	}
+	defer conn.Close()
+
+	payload := udpPayloads[port]
+	buf := make([]byte, 1500)
+	for attempt := 0; attempt < 2; attempt++ {
+		if _, err := conn.Write(payload); err != nil {
+			if isConnRefused(err) {
+				return portClosed
+			}
+			return portOpenFiltered
+		}
+		conn.SetReadDeadline(time.Now().Add(ps.timeout))
+		_, err := conn.Read(buf)
+		if err == nil {
+			return portOpen
+		}
+		if isConnRefused(err) {
+			return portClosed
+		}
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			return portOpenFiltered
+		}
+	}
+	return portOpenFiltered
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// udpPingTimeout is how long a UDP ping waits for a reply or an ICMP
+// port unreachable.
+const udpPingTimeout = time.Second
+
+// scanUDPPing sends an empty datagram to port on every target that
+// hasn't been found yet. A reply or an ICMP port unreachable, which a
+// connected socket reports as a refused connection, proves the host is
+// up; silence proves nothing. It returns how many targets the deadline
+// left unprobed.
+func scanUDPPing(targets targetSet, first []uint32, port int) int64 {
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < max(*concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ip := range jobs {
+				if rtt, ok := udpPing(ip, port); ok {
+					recordRTT(ip, rtt)
+					add(ip, "udp")
+				}
+			}
+		}()
+	}
+
+	var unprobed int64
+	forEachTarget(targets, first, func(ip uint32) {
+		target := intToIP(ip)
+		if found(target) {
+			return
+		}
+		scanGate.wait()
+		if pastDeadline() {
+			unprobed++
+			return
+		}
+		jobs <- target
+	})
+	close(jobs)
+	wg.Wait()
+	return unprobed
+}
+
+// udpPing reports whether ip answered a datagram to port, and how fast.
+func udpPing(ip string, port int) (time.Duration, bool) {
+	sendLimiter.acquire()
+	defer sendLimiter.release()
+	conn, err := net.Dial("udp4", net.JoinHostPort(ip, strconv.Itoa(port)))
+	if err != nil {
+		if isResourceError(err) {
+			sendLimiter.reduce(err)
+		}
+		return 0, false
+	}
+	defer conn.Close()
+	engineStats.inFlight.Add(1)
+	defer engineStats.inFlight.Add(-1)
+	engineStats.sent.Add(1)
+	start := time.Now()
+	if _, err := conn.Write(nil); err != nil {
+		if isResourceError(err) {
+			sendLimiter.reduce(err)
+		}
+		return time.Since(start), isConnRefused(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(udpPingTimeout))
+	_, err = conn.Read(make([]byte, 1))
+	if err == nil || isConnRefused(err) {
+		engineStats.replies.Add(1)
+		return time.Since(start), true
+	}
+	engineStats.timeouts.Add(1)
+	return 0, false
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// expectations are the checks "scli verify" makes against scan results.
+type expectations struct {
+	up      []string
+	countOp string
+	count   int
+}
+
+// parseVerifyArgs parses the flags that follow "scli verify".
+func parseVerifyArgs(args []string) (*expectations, error) {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	up := fs.String("expect-up", "", "comma-separated hosts or IPs that must answer")
+	count := fs.String("expect-count", "", "required number of live hosts, e.g. >=10, <5 or 12")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	e := &expectations{}
+	for _, h := range strings.Split(*up, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			e.up = append(e.up, h)
+		}
+	}
+	if *count != "" {
+		op, n, err := parseCountExpr(*count)
+		if err != nil {
+			return nil, err
+		}
+		e.countOp, e.count = op, n
+	}
+	return e, nil
+}
+
+// parseCountExpr splits an expression like ">=10" into its operator and
+// number. A bare number means exactly that many.
+func parseCountExpr(expr string) (string, int, error) {
+	expr = strings.TrimSpace(expr)
+	op := "="
+	for _, o := range []string{">=", "<=", "==", ">", "<", "="} {
+		if strings.HasPrefix(expr, o) {
+			op, expr = o, expr[len(o):]
+			break
+		}
+	}
+	if op == "==" {
+		op = "="
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(expr))
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid --expect-count %q", expr)
+	}
+	return op, n, nil
+}
+
+func compareCount(got int, op string, want int) bool {
+	switch op {
+	case ">=":
+		return got >= want
+	case "<=":
+		return got <= want
+	case ">":
+		return got > want
+	case "<":
+		return got < want
+	default:
+		return got == want
+	}
+}
+
+// check logs each expectation as PASS or FAIL and reports whether all held.
+func (e *expectations) check(found []string) bool {
+	live := make(map[string]bool, len(found))
+	for _, ip := range found {
+		live[ip] = true
+	}
+
+	ok := true
+	for _, host := range e.up {
+		addrs, err := net.LookupHost(host)
+		if err != nil {
+			log.Printf("FAIL %s: %s", displayHost(host), redactText(err.Error()))
+			ok = false
+			continue
+		}
+		up := false
+		for _, addr := range addrs {
+			if live[addr] {
+				up = true
+				break
+			}
+		}
+		if up {
+			log.Printf("PASS %s is up", displayHost(host))
+		} else {
+			log.Printf("FAIL %s is not up", displayHost(host))
+			ok = false
+		}
+	}
+
+	if e.countOp != "" {
+		if compareCount(len(found), e.countOp, e.count) {
+			log.Printf("PASS host count %d %s %d", len(found), e.countOp, e.count)
+		} else {
+			log.Printf("FAIL host count %d, expected %s%d", len(found), e.countOp, e.count)
+			ok = false
+		}
+	}
+	return ok
+}
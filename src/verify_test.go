@@ -0,0 +1,74 @@
+package main
+
+import "testing"
+
+func TestParseCountExpr(t *testing.T) {
+	for _, tt := range []struct {
+		expr string
+		op   string
+		n    int
+	}{
+		{"12", "=", 12},
+		{" >=10 ", ">=", 10},
+		{"<= 3", "<=", 3},
+		{">0", ">", 0},
+		{"<5", "<", 5},
+		{"==7", "=", 7},
+		{"=7", "=", 7},
+	} {
+		op, n, err := parseCountExpr(tt.expr)
+		if err != nil || op != tt.op || n != tt.n {
+			t.Errorf("parseCountExpr(%q) = %q, %d, %v, want %q, %d", tt.expr, op, n, err, tt.op, tt.n)
+		}
+	}
+	for _, bad := range []string{"", ">=", "ten", "=>5", "!=3", "5.5"} {
+		if _, _, err := parseCountExpr(bad); err == nil {
+			t.Errorf("parseCountExpr(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestCompareCount(t *testing.T) {
+	for _, tt := range []struct {
+		got  int
+		op   string
+		want int
+		ok   bool
+	}{
+		{10, ">=", 10, true},
+		{9, ">=", 10, false},
+		{3, "<=", 3, true},
+		{4, "<=", 3, false},
+		{1, ">", 0, true},
+		{0, ">", 0, false},
+		{4, "<", 5, true},
+		{5, "<", 5, false},
+		{12, "=", 12, true},
+		{11, "=", 12, false},
+	} {
+		if ok := compareCount(tt.got, tt.op, tt.want); ok != tt.ok {
+			t.Errorf("%d %s %d = %v", tt.got, tt.op, tt.want, ok)
+		}
+	}
+}
+
+func TestParseVerifyArgs(t *testing.T) {
+	e, err := parseVerifyArgs([]string{"--expect-up", "router.lan, 10.0.0.5,", "--expect-count", ">=2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalStrings(e.up, []string{"router.lan", "10.0.0.5"}) || e.countOp != ">=" || e.count != 2 {
+		t.Errorf("expectations = %+v", e)
+	}
+	if e, err := parseVerifyArgs(nil); err != nil || len(e.up) != 0 || e.countOp != "" {
+		t.Errorf("no expectations = %+v, %v", e, err)
+	}
+	for _, args := range [][]string{
+		{"--expect-count", "lots"},
+		{"--expect-up", "10.0.0.1", "extra"},
+	} {
+		if _, err := parseVerifyArgs(args); err == nil {
+			t.Errorf("parseVerifyArgs(%q) succeeded", args)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sort"
+)
+
+// buildVersion returns the module version and VCS revision baked into the
+// binary by the Go toolchain.
+func buildVersion() (version, revision string) {
+	version = "(devel)"
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return version, ""
+	}
+	if bi.Main.Version != "" {
+		version = bi.Main.Version
+	}
+	for _, s := range bi.Settings {
+		if s.Key == "vcs.revision" {
+			revision = s.Value
+		}
+	}
+	return version, revision
+}
+
+// runVersion implements "scli version [--build-info]".
+func runVersion(args []string) error {
+	fs := flag.NewFlagSet("version", flag.ContinueOnError)
+	buildInfo := fs.Bool("build-info", false, "also print build metadata, probe backends and features")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	version, revision := buildVersion()
+	fmt.Printf("scli %s", version)
+	if revision != "" {
+		fmt.Printf(" (%s)", revision)
+	}
+	fmt.Println()
+	if !*buildInfo {
+		return nil
+	}
+
+	fmt.Printf("\ngo:       %s\nplatform: %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		fmt.Println("\nbuild:")
+		for _, s := range bi.Settings {
+			fmt.Printf("  %s=%s\n", s.Key, s.Value)
+		}
+	}
+	fmt.Println("\nprobe backends:")
+	printSupport(os.Stdout, knownBackends)
+	fmt.Println("\nfeatures:")
+	printSupport(os.Stdout, knownFeatures)
+	return nil
+}
+
+// printSupport lists each named feature with whether this binary has it.
+func printSupport(w io.Writer, names []string) {
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+	for _, name := range sorted {
+		state := "no"
+		if featureEnabled(name) {
+			state = "yes"
+		}
+		fmt.Fprintf(w, "  %-18s %s\n", name, state)
+	}
+}